@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	_ "time/tzdata" // 内置时区数据库，精简镜像中没有 /usr/share/zoneinfo 时也能使用配置的时区
 
 	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/netstat"
 	"docker-cycler/pkg/server"
+	"docker-cycler/pkg/urlpool"
 )
 
 //go:embed templates/*
@@ -23,6 +26,13 @@ func main() {
 	// 启动调度器
 	server.StartScheduler()
 
+	// 启动镜像测速
+	urlpool.StartProber()
+
+	// 启动网卡流量监控和比例模式
+	netstat.StartMonitor()
+	server.StartRatioKeeper()
+
 	// 注册HTTP路由
 	server.RegisterHandlers()
 
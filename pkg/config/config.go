@@ -6,18 +6,59 @@ import (
 	"sync"
 )
 
+// URLEntry 是下载地址列表中的一项
+type URLEntry struct {
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"` // 加权随机策略使用的权重
+	Enabled bool   `json:"enabled"`
+}
+
 // Config 结构体定义了所有可配置的参数
 type Config struct {
-	URL                 string `json:"url"`
-	PlanType            string `json:"plan_type"` // "daily" or "interval"
-	IntervalMinutes     int    `json:"interval_minutes"`
-	Hour                int    `json:"hour"`
-	Minute              int    `json:"minute"`
-	SpeedKB             int    `json:"speed_kb"`
-	Dir                 string `json:"dir"`
-	LimitMB             int    `json:"limit_mb"`
-	TaskEnabled         bool   `json:"task_enabled"`         // 自动任务是否启用
-	DailyLimitEnabled   bool   `json:"daily_limit_enabled"`  // 每日下载量限制是否启用
+	URL                  string       `json:"url,omitempty"` // 已废弃，仅用于迁移旧版本的单一地址配置
+	URLs                 []URLEntry   `json:"urls"`
+	URLStrategy          string       `json:"url_strategy"` // "round_robin", "weighted", "fastest" or "failover"
+	PlanType             string       `json:"plan_type"`    // "daily", "interval", "cron" or "continuous"
+	CronExpr             string       `json:"cron_expr"`    // 五段式 cron 表达式，PlanType 为 "cron" 时使用
+	IntervalMinutes      int          `json:"interval_minutes"`
+	CooldownSeconds      int          `json:"cooldown_seconds"` // 持续下载时每次结束后的等待时间
+	Hour                 int          `json:"hour"`
+	Minute               int          `json:"minute"`
+	JitterMinutes        int          `json:"jitter_minutes"` // 每日执行时间的随机偏移范围（正负分钟）
+	CatchUp              string       `json:"catch_up"`       // 错过每日执行时的处理: "skip", "once" or "all"
+	SpeedKB              int          `json:"speed_kb"`
+	Dir                  string       `json:"dir"`
+	LimitMB              int          `json:"limit_mb"`
+	TaskEnabled          bool         `json:"task_enabled"`           // 自动任务是否启用
+	DailyLimitEnabled    bool         `json:"daily_limit_enabled"`    // 每日下载量限制是否启用
+	MonthlyLimitEnabled  bool         `json:"monthly_limit_enabled"`  // 每月下载量限制是否启用
+	MonthlyLimitMB       int          `json:"monthly_limit_mb"`       // 每个计费周期的下载量上限
+	BillingDay           int          `json:"billing_day"`            // 每月计费周期开始的日期，1-31
+	HistoryMonths        int          `json:"history_months"`         // 按天的历史统计的保留月数，按小时的只保留 31 天
+	SinkMode             bool         `json:"sink_mode"`              // 丢弃模式：数据直接丢弃，不写入磁盘
+	Connections          int          `json:"connections"`            // 并发连接数，所有连接共享 SpeedKB 限速
+	ProbeIntervalMinutes int          `json:"probe_interval_minutes"` // 镜像测速间隔，0 表示不自动测速
+	ProbeSizeKB          int          `json:"probe_size_kb"`          // 每次测速下载的数据量
+	RetryCount           int          `json:"retry_count"`            // 下载失败后的最大重试次数
+	RetryDelaySeconds    int          `json:"retry_delay_seconds"`    // 首次重试的等待时间，之后指数增长
+	RunLimitMB           int          `json:"run_limit_mb"`           // 单次下载量上限，0 表示下载到文件结束
+	RunLimitMinutes      int          `json:"run_limit_minutes"`      // 单次下载时长上限，0 表示不限制
+	Tasks                []Task       `json:"tasks"`                  // 主任务之外的自定义任务
+	SpeedProfileEnabled  bool         `json:"speed_profile_enabled"`  // 是否按每周速度计划调整限速
+	SpeedProfile         []int        `json:"speed_profile"`          // 每周 7x24 小时的限速，见 SpeedProfileAt
+	ActiveWindowsEnabled bool         `json:"active_windows_enabled"` // 是否只在允许的时段内下载
+	ActiveWindows        []TimeWindow `json:"active_windows"`         // 每天允许下载的时段
+	PacingEnabled        bool         `json:"pacing_enabled"`         // 匀速模式：按每日目标下载量动态计算限速
+	PacingTargetMB       int          `json:"pacing_target_mb"`       // 匀速模式的每日目标下载量
+	RatioEnabled         bool         `json:"ratio_enabled"`          // 比例模式：按网卡实际收发量保持下载:上传比
+	RatioInterface       string       `json:"ratio_interface"`        // 比例模式监控的网卡，如 eth0
+	RatioTarget          float64      `json:"ratio_target"`           // 目标下载:上传比，如 3 表示下载量至少为上传量的 3 倍
+	NetDevPath           string       `json:"net_dev_path"`           // 网卡流量计数器文件，格式同 /proc/net/dev
+	MonitorInterfaces    []string     `json:"monitor_interfaces"`     // 需要统计流量的网卡
+	LimitSource          string       `json:"limit_source"`           // 下载量限制的统计口径: "self", "interface_rx" or "interface_total"
+	MaxConcurrent        int          `json:"max_concurrent"`         // 同时下载的任务数上限，其余任务在队列中等待
+	Timezone             string       `json:"timezone"`               // IANA 时区，如 "Asia/Shanghai"，为空时使用系统本地时区
+	Humanize             Humanize     `json:"humanize"`               // 拟人化下载，使下载规律不那么明显
 }
 
 var (
@@ -48,6 +89,16 @@ func LoadConfig() error {
 	if err != nil {
 		// 解析失败，使用默认值
 		config = DefaultConfig()
+		return nil
+	}
+
+	// 迁移旧版本的单一下载地址
+	if config.URL != "" {
+		if len(config.URLs) == 0 {
+			config.URLs = []URLEntry{{URL: config.URL, Weight: 1, Enabled: true}}
+		}
+		config.URL = ""
+		return SaveConfigLocked()
 	}
 	return nil
 }
@@ -116,6 +167,13 @@ func SetDailyLimitEnabled(enabled bool) error {
 	return SaveConfigLocked()
 }
 
+// GetMonthlyLimitEnabled 获取每月下载量限制启用状态
+func GetMonthlyLimitEnabled() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config.MonthlyLimitEnabled
+}
+
 // ToggleTaskEnabled 切换自动任务启用状态
 func ToggleTaskEnabled() (bool, error) {
 	configLock.Lock()
@@ -134,18 +192,67 @@ func ToggleDailyLimitEnabled() (bool, error) {
 	return config.DailyLimitEnabled, err
 }
 
+// ToggleMonthlyLimitEnabled 切换每月下载量限制启用状态
+func ToggleMonthlyLimitEnabled() (bool, error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	config.MonthlyLimitEnabled = !config.MonthlyLimitEnabled
+	err := SaveConfigLocked()
+	return config.MonthlyLimitEnabled, err
+}
+
 // DefaultConfig 返回一个默认的配置实例
 func DefaultConfig() Config {
 	return Config{
-		URL:                 "",
-		PlanType:            "interval",
-		IntervalMinutes:     30,
-		Hour:                3,
-		Minute:              0,
-		SpeedKB:             0,    // 0 表示不限速
-		Dir:                 "tmp",
-		LimitMB:             1024,
-		TaskEnabled:         true,  
-		DailyLimitEnabled:   false, 
+		URLs:                 []URLEntry{},
+		URLStrategy:          "round_robin",
+		PlanType:             "interval",
+		IntervalMinutes:      30,
+		CooldownSeconds:      0,
+		Hour:                 3,
+		Minute:               0,
+		JitterMinutes:        0,
+		CatchUp:              "skip",
+		CronExpr:             "0 3 * * *",
+		SpeedKB:              0, // 0 表示不限速
+		Dir:                  "tmp",
+		LimitMB:              1024,
+		TaskEnabled:          true,
+		DailyLimitEnabled:    false,
+		MonthlyLimitEnabled:  false,
+		MonthlyLimitMB:       30720,
+		BillingDay:           1,
+		HistoryMonths:        12,
+		SinkMode:             false,
+		Connections:          1,
+		ProbeIntervalMinutes: 0,
+		ProbeSizeKB:          1024,
+		RetryCount:           3,
+		RetryDelaySeconds:    5,
+		RunLimitMB:           0,
+		RunLimitMinutes:      0,
+		Tasks:                []Task{},
+		SpeedProfileEnabled:  false,
+		SpeedProfile:         []int{},
+		ActiveWindowsEnabled: false,
+		ActiveWindows:        []TimeWindow{},
+		PacingEnabled:        false,
+		PacingTargetMB:       1024,
+		RatioEnabled:         false,
+		RatioInterface:       "eth0",
+		RatioTarget:          1,
+		NetDevPath:           "/proc/net/dev",
+		MonitorInterfaces:    []string{},
+		LimitSource:          "self",
+		Timezone:             "",
+		MaxConcurrent:        1,
+	}
+}
+
+// PacingTargetBytes 返回匀速模式的每日目标下载量（字节），未启用时返回 0
+func (c Config) PacingTargetBytes() int64 {
+	if !c.PacingEnabled || c.PacingTargetMB <= 0 {
+		return 0
 	}
+	return int64(c.PacingTargetMB) * 1024 * 1024
 }
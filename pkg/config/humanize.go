@@ -0,0 +1,47 @@
+package config
+
+import "errors"
+
+// Humanize 是拟人化下载的参数，使下载的开始时间、下载量、速度和停顿不那么规律
+// 每组范围的上限为 0 时表示不启用该项
+type Humanize struct {
+	Enabled            bool  `json:"enabled"`
+	Seed               int64 `json:"seed"`                 // 随机种子，相同的种子产生相同的随机序列，0 表示每次启动时随机生成
+	StartJitterSeconds int   `json:"start_jitter_seconds"` // 定时触发后随机推迟 0 到该秒数再开始下载
+	RunMinMB           int   `json:"run_min_mb"`           // 每次下载量在 [RunMinMB, RunMaxMB] 之间随机
+	RunMaxMB           int   `json:"run_max_mb"`
+	RateMinKB          int   `json:"rate_min_kb"` // 下载速度在 [RateMinKB, RateMaxKB] 之间随机变化
+	RateMaxKB          int   `json:"rate_max_kb"`
+	IdleEveryMinutes   int   `json:"idle_every_minutes"` // 平均每隔多少分钟随机停顿一次
+	IdleMinSeconds     int   `json:"idle_min_seconds"`   // 每次停顿的时长在 [IdleMinSeconds, IdleMaxSeconds] 之间随机
+	IdleMaxSeconds     int   `json:"idle_max_seconds"`
+}
+
+// Validate 检查拟人化参数的取值范围
+func (h Humanize) Validate() error {
+	for _, v := range []int{h.StartJitterSeconds, h.RunMinMB, h.RunMaxMB, h.RateMinKB, h.RateMaxKB,
+		h.IdleEveryMinutes, h.IdleMinSeconds, h.IdleMaxSeconds} {
+		if v < 0 {
+			return errors.New("拟人化参数不能为负数")
+		}
+	}
+	if h.RunMaxMB > 0 && h.RunMinMB > h.RunMaxMB {
+		return errors.New("随机下载量的下限不能大于上限")
+	}
+	if h.RateMaxKB > 0 && h.RateMinKB > h.RateMaxKB {
+		return errors.New("随机速度的下限不能大于上限")
+	}
+	if h.IdleMaxSeconds > 0 && h.IdleMinSeconds > h.IdleMaxSeconds {
+		return errors.New("随机停顿时长的下限不能大于上限")
+	}
+	return nil
+}
+
+// ActiveHumanize 返回启用中的拟人化参数，未启用时返回 nil
+func (c Config) ActiveHumanize() *Humanize {
+	if !c.Humanize.Enabled {
+		return nil
+	}
+	h := c.Humanize
+	return &h
+}
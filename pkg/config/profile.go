@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// ProfileSlots 是速度计划的格子数，每周每小时一格，下标为 星期*24+小时（星期日为0）
+	ProfileSlots = 7 * 24
+
+	// SpeedUnlimited 表示该时段不限速
+	SpeedUnlimited = -1
+	// SpeedPaused 表示该时段暂停下载
+	SpeedPaused = 0
+)
+
+// ValidateSpeedProfile 检查速度计划的格式，空计划表示未设置
+func ValidateSpeedProfile(profile []int) error {
+	if len(profile) == 0 {
+		return nil
+	}
+	if len(profile) != ProfileSlots {
+		return errors.New("速度计划必须包含 7x24 个时段")
+	}
+	for _, v := range profile {
+		if v < SpeedUnlimited {
+			return errors.New("速度计划中的限速不能小于 -1")
+		}
+	}
+	return nil
+}
+
+// SpeedProfileAt 返回速度计划在 t 时刻的限速（KB/s）
+// SpeedUnlimited 表示不限速，SpeedPaused 表示暂停；计划未设置时返回 SpeedUnlimited
+func SpeedProfileAt(profile []int, t time.Time) int {
+	if len(profile) != ProfileSlots {
+		return SpeedUnlimited
+	}
+	return profile[int(t.Weekday())*24+t.Hour()]
+}
+
+// ActiveSpeedProfile 返回启用中的速度计划，未启用时返回 nil
+func (c Config) ActiveSpeedProfile() []int {
+	if !c.SpeedProfileEnabled || len(c.SpeedProfile) != ProfileSlots {
+		return nil
+	}
+	return c.SpeedProfile
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MainTaskID 是由主配置构成的内置任务的ID
+const MainTaskID = "main"
+
+// MaxJitterMinutes 是每日执行时间随机偏移的上限，保证每天的执行时间仍然按天先后排列
+const MaxJitterMinutes = 12 * 60
+
+// ErrTaskNotFound 表示指定的任务不存在
+var ErrTaskNotFound = errors.New("任务不存在")
+
+// Task 是一个独立的定时下载任务，拥有自己的地址、计划和限速
+// 下载目录、重试、额度等其他设置与主配置共用
+type Task struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Enabled         bool       `json:"enabled"`
+	URLs            []URLEntry `json:"urls"`
+	URLStrategy     string     `json:"url_strategy"`
+	PlanType        string     `json:"plan_type"` // "daily", "interval", "cron" or "continuous"
+	IntervalMinutes int        `json:"interval_minutes"`
+	CooldownSeconds int        `json:"cooldown_seconds"`
+	Hour            int        `json:"hour"`
+	Minute          int        `json:"minute"`
+	JitterMinutes   int        `json:"jitter_minutes"` // 每日执行时间的随机偏移范围（正负分钟）
+	CatchUp         string     `json:"catch_up"`       // 错过每日执行时的处理: "skip", "once" or "all"
+	CronExpr        string     `json:"cron_expr"`
+	SpeedKB         int        `json:"speed_kb"`
+}
+
+// ValidCatchUp 判断是否为支持的补跑策略
+func ValidCatchUp(policy string) bool {
+	switch policy {
+	case "skip", "once", "all":
+		return true
+	}
+	return false
+}
+
+// MainTask 将主配置中的地址和计划转换为内置任务
+func (c Config) MainTask() Task {
+	return Task{
+		ID:              MainTaskID,
+		Name:            "主任务",
+		Enabled:         c.TaskEnabled,
+		URLs:            c.URLs,
+		URLStrategy:     c.URLStrategy,
+		PlanType:        c.PlanType,
+		IntervalMinutes: c.IntervalMinutes,
+		CooldownSeconds: c.CooldownSeconds,
+		Hour:            c.Hour,
+		Minute:          c.Minute,
+		JitterMinutes:   c.JitterMinutes,
+		CatchUp:         c.CatchUp,
+		CronExpr:        c.CronExpr,
+		SpeedKB:         c.SpeedKB,
+	}
+}
+
+// AllTasks 返回内置主任务和所有自定义任务
+func (c Config) AllTasks() []Task {
+	return append([]Task{c.MainTask()}, c.Tasks...)
+}
+
+// GetTask 按ID查找任务，包括内置主任务
+func GetTask(id string) (Task, bool) {
+	cfg := GetConfig()
+	for _, t := range cfg.AllTasks() {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Task{}, false
+}
+
+// AddTask 添加一个自定义任务并保存配置，返回带有新ID的任务
+func AddTask(t Task) (Task, error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	t.ID = "task_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	// GetConfig 返回的副本与 config 共用任务切片，修改时总是创建新的切片
+	config.Tasks = append(slices.Clip(config.Tasks), t)
+	return t, SaveConfigLocked()
+}
+
+// UpdateTask 替换指定ID的自定义任务并保存配置
+func UpdateTask(t Task) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+	for i := range config.Tasks {
+		if config.Tasks[i].ID == t.ID {
+			tasks := slices.Clone(config.Tasks)
+			tasks[i] = t
+			config.Tasks = tasks
+			return SaveConfigLocked()
+		}
+	}
+	return ErrTaskNotFound
+}
+
+// DeleteTask 删除指定ID的自定义任务并保存配置
+func DeleteTask(id string) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+	for i := range config.Tasks {
+		if config.Tasks[i].ID == id {
+			config.Tasks = slices.Delete(slices.Clone(config.Tasks), i, i+1)
+			return SaveConfigLocked()
+		}
+	}
+	return ErrTaskNotFound
+}
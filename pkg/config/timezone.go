@@ -0,0 +1,44 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// locations 缓存已加载的时区，避免每次都解析时区数据库
+	locations     = make(map[string]*time.Location)
+	locationsLock sync.Mutex
+)
+
+// LoadLocation 加载 IANA 时区（如 "Asia/Shanghai"），空字符串或 "Local" 表示系统本地时区
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return time.Local, nil
+	}
+	locationsLock.Lock()
+	defer locationsLock.Unlock()
+	if loc, ok := locations[name]; ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations[name] = loc
+	return loc, nil
+}
+
+// Location 返回配置的时区，未设置或无效时使用系统本地时区
+func (c Config) Location() *time.Location {
+	loc, err := LoadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Now 返回配置时区的当前时间，计划、统计重置和显示的时间都以此为准
+func Now() time.Time {
+	return time.Now().In(GetConfig().Location())
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeWindow 是每天允许下载的一个时段，格式为 "15:04"
+// End 早于 Start 时表示跨越午夜，Start 等于 End 时表示全天
+type TimeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// parseClock 将 "15:04" 格式的时间转换为当天的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间 %q，应为 HH:MM 格式", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateWindows 检查所有时段的格式
+func ValidateWindows(windows []TimeWindow) error {
+	for _, w := range windows {
+		if _, err := parseClock(w.Start); err != nil {
+			return err
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contains 判断 t 是否落在时段内
+func (w TimeWindow) contains(t time.Time) bool {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return now >= start && now < end
+	default:
+		return now >= start || now < end
+	}
+}
+
+// WindowOpen 判断 t 是否在任一允许的时段内，未设置时段时始终允许
+func WindowOpen(windows []TimeWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindowOpen 返回 t 之后最近一个时段的开始时间，未设置有效时段时返回零值
+func NextWindowOpen(windows []TimeWindow, t time.Time) time.Time {
+	var next time.Time
+	for _, w := range windows {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			continue
+		}
+		at := time.Date(t.Year(), t.Month(), t.Day(), start/60, start%60, 0, 0, t.Location())
+		if !at.After(t) {
+			at = at.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+// OpenDuration 返回 [from, to) 之间落在允许时段内的总时长，未设置时段时为整个区间
+func OpenDuration(windows []TimeWindow, from, to time.Time) time.Duration {
+	if len(windows) == 0 {
+		return to.Sub(from)
+	}
+	var open time.Duration
+	for t := from; t.Before(to); {
+		// 时段精确到分钟，逐分钟累加；按绝对时间前进，夏令时切换时不会回退
+		next := t.Truncate(time.Minute).Add(time.Minute)
+		if next.After(to) {
+			next = to
+		}
+		if WindowOpen(windows, t) {
+			open += next.Sub(t)
+		}
+		t = next
+	}
+	return open
+}
+
+// ActiveWindowList 返回启用中的允许时段，未启用时返回 nil
+func (c Config) ActiveWindowList() []TimeWindow {
+	if !c.ActiveWindowsEnabled || len(c.ActiveWindows) == 0 {
+		return nil
+	}
+	return c.ActiveWindows
+}
+
+// WindowClosed 判断 t 时刻是否不在允许的时段内，并返回提示原因
+func (c Config) WindowClosed(t time.Time) (string, bool) {
+	windows := c.ActiveWindowList()
+	if WindowOpen(windows, t) {
+		return "", false
+	}
+	reason := "当前不在允许的下载时段内"
+	if next := NextWindowOpen(windows, t); !next.IsZero() {
+		reason += "，下一个时段 " + next.Format("15:04") + " 开始"
+	}
+	return reason, true
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpenDuration(t *testing.T) {
+	windows := []TimeWindow{{Start: "01:00", End: "06:00"}, {Start: "22:00", End: "02:00"}}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 00:00-06:00 和 22:00-24:00
+	if got, want := OpenDuration(windows, from, from.Add(24*time.Hour)), 8*time.Hour; got != want {
+		t.Errorf("得到 %v，期望 %v", got, want)
+	}
+	if got, want := OpenDuration(windows, from.Add(90*time.Second), from.Add(150*time.Second)), time.Minute; got != want {
+		t.Errorf("不足一分钟的区间: 得到 %v，期望 %v", got, want)
+	}
+	if got, want := OpenDuration(nil, from, from.Add(time.Hour)), time.Hour; got != want {
+		t.Errorf("未设置时段: 得到 %v，期望 %v", got, want)
+	}
+}
+
+func TestOpenDurationDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("时区不可用: %v", err)
+	}
+	windows := []TimeWindow{{Start: "00:00", End: "06:00"}}
+	tests := []struct {
+		from, to time.Time
+		want     time.Duration
+	}{
+		// 2026-03-08 02:00 跳到 03:00，00:30 到 06:00 实际只有 4.5 小时
+		{time.Date(2026, 3, 8, 0, 30, 0, 0, ny), time.Date(2026, 3, 8, 8, 0, 0, 0, ny), 4*time.Hour + 30*time.Minute},
+		// 2026-11-01 01:00 到 02:00 重复一次，00:00 到 06:00 实际有 7 小时
+		{time.Date(2026, 11, 1, 0, 0, 0, 0, ny), time.Date(2026, 11, 1, 8, 0, 0, 0, ny), 7 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := OpenDuration(windows, tt.from, tt.to); got != tt.want {
+			t.Errorf("从 %v 到 %v: 得到 %v，期望 %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
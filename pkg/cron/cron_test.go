@@ -0,0 +1,197 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("时区 %s 不可用: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			expr: "*/15 * * * *",
+			from: time.Date(2026, 1, 1, 10, 7, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC),
+				time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC),
+				time.Date(2026, 1, 1, 10, 45, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "0 9-17/4 * * *",
+			from: time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 1, 17, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "30 2 1,15 * *",
+			from: time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 15, 2, 30, 0, 0, time.UTC),
+				time.Date(2026, 2, 1, 2, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// 2026-01-01 是周四，日和周都有限制时满足其一即可
+			expr: "0 0 10 * 1",
+			from: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// 日字段以 "*" 开头时不算限制，需要同时满足周字段：1 月的单数日中的工作日
+			expr: "0 3 */2 * 1-5",
+			from: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 5, 3, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 7, 3, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 9, 3, 0, 0, 0, time.UTC),
+				time.Date(2026, 1, 13, 3, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// 周字段以 "*" 开头同样不算限制：每月 10 日和 20 日中的周日、周三、周六
+			expr: "0 0 10,20 * */3",
+			from: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// 7 和 0 都表示周日
+			expr: "0 12 * 2 7",
+			from: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC),
+				time.Date(2026, 2, 8, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "5/20 0 * * *",
+			from: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 1, 0, 5, 0, 0, time.UTC),
+				time.Date(2026, 1, 1, 0, 25, 0, 0, time.UTC),
+				time.Date(2026, 1, 1, 0, 45, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		got := s.NextN(tt.from, len(tt.want))
+		if len(got) != len(tt.want) {
+			t.Fatalf("%q: 得到 %d 个时间，期望 %d 个", tt.expr, len(got), len(tt.want))
+		}
+		for i := range got {
+			if !got[i].Equal(tt.want[i]) {
+				t.Errorf("%q 第 %d 次: 得到 %v，期望 %v", tt.expr, i+1, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) 应该返回错误", expr)
+		}
+	}
+}
+
+func TestNoMatch(t *testing.T) {
+	s, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !next.IsZero() {
+		t.Errorf("2 月 31 日不存在，得到 %v", next)
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	// 圣地亚哥在午夜进入夏令时，2026-09-06 00:00 不存在
+	santiago := mustLoad(t, "America/Santiago")
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// 2026-03-08 02:00 跳到 03:00
+		{"0 3 * * *", time.Date(2026, 3, 8, 0, 30, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		{"30 4 * * *", time.Date(2026, 3, 8, 1, 0, 0, 0, ny), time.Date(2026, 3, 8, 4, 30, 0, 0, ny)},
+		// 被跳过的 02:30 当天不触发
+		{"30 2 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, ny), time.Date(2026, 3, 9, 2, 30, 0, 0, ny)},
+		{"*/10 * * * *", time.Date(2026, 3, 8, 1, 55, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		// 2026-11-01 01:00 到 02:00 重复一次
+		{"0 3 * * *", time.Date(2026, 11, 1, 0, 30, 0, 0, ny), time.Date(2026, 11, 1, 3, 0, 0, 0, ny)},
+		{"0 12 * * *", time.Date(2026, 9, 5, 13, 0, 0, 0, santiago), time.Date(2026, 9, 6, 12, 0, 0, 0, santiago)},
+		{"0 12 * * 1", time.Date(2026, 9, 5, 13, 0, 0, 0, santiago), time.Date(2026, 9, 7, 12, 0, 0, 0, santiago)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q 从 %v: 得到 %v，期望 %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestNextStrictlyIncreasesAcrossDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	s, err := Parse("*/7 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, from := range []time.Time{
+		time.Date(2026, 3, 7, 22, 0, 0, 0, ny),
+		time.Date(2026, 10, 31, 22, 0, 0, 0, ny),
+	} {
+		prev := from
+		for i := 0; i < 100; i++ {
+			next := s.Next(prev)
+			if !next.After(prev) {
+				t.Fatalf("Next(%v) = %v，没有向后推进", prev, next)
+			}
+			prev = next
+		}
+	}
+}
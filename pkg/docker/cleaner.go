@@ -1,51 +1,67 @@
 package docker
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	// "time"
+	"strings"
+	"time"
 
 	"docker-cycler/pkg/config"
 )
 
-// const cacheDuration = 24 * time.Hour // 超过这个时间的文件会被清理
+// legacyFilePrefix 是旧版本下载文件名的前缀，这些文件不属于任何任务
+const legacyFilePrefix = "file_"
 
-// CleanCache 遍历下载目录并删除过期的文件
+// TaskFileName 返回任务一次下载使用的文件名，格式为 "<任务ID>-<纳秒时间戳>"
+// 任务ID中不含 "-"，据此可以找到文件所属的任务
+func TaskFileName(taskID string, t time.Time) string {
+	return fmt.Sprintf("%s-%d", taskID, t.UnixNano())
+}
+
+// fileTask 返回下载文件所属的任务ID，不是任务的下载文件时返回空字符串
+func fileTask(name string) string {
+	id, _, ok := strings.Cut(name, "-")
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// CleanCache 删除下载目录中的文件，正在下载的任务的文件除外
 func CleanCache() int {
-	cfg := config.GetConfig()
-	files, err := os.ReadDir(cfg.Dir)
+	return cleanDir(config.GetConfig().Dir, func(name string) bool {
+		id := fileTask(name)
+		return id == "" || !TaskBusy(id)
+	})
+}
+
+// CleanTaskCache 删除任务之前下载留下的文件，不影响其他任务正在写入的文件
+// 旧版本的下载文件由主任务清理
+func CleanTaskCache(dir, taskID string) int {
+	return cleanDir(dir, func(name string) bool {
+		if taskID == config.MainTaskID && strings.HasPrefix(name, legacyFilePrefix) {
+			return true
+		}
+		return fileTask(name) == taskID
+	})
+}
+
+// cleanDir 删除目录中满足条件的文件，返回删除的数量
+func cleanDir(dir string, remove func(name string) bool) int {
+	files, err := os.ReadDir(dir)
 	if err != nil {
-		log.Printf("清理缓存失败，无法读取目录 '%s': %v", cfg.Dir, err)
+		log.Printf("清理缓存失败，无法读取目录 '%s': %v", dir, err)
 		return 0
 	}
 
 	count := 0
-	// now := time.Now()
 	for _, f := range files {
-		if f.IsDir() {
-			continue // 跳过子目录
-		}
-		info, err := f.Info()
-		if err != nil {
-			continue
+		if f.IsDir() || !remove(f.Name()) {
+			continue // 跳过子目录和其他任务的文件
 		}
-
-		_ = info
-
-		// 删除过期文件
-		// if now.Sub(info.ModTime()) > cacheDuration {
-		// 	err := os.Remove(filepath.Join(cfg.Dir, f.Name()))
-		// 	if err != nil {
-		// 		log.Printf("无法删除文件 '%s': %v", f.Name(), err)
-		// 	} else {
-		// 		count++
-		// 	}
-		// }
-
-		// 删除所有文件
-		err = os.Remove(filepath.Join(cfg.Dir, f.Name()))
-		if err != nil {
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
 			log.Printf("无法删除文件 '%s': %v", f.Name(), err)
 		} else {
 			count++
@@ -0,0 +1,184 @@
+package docker
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"docker-cycler/pkg/config"
+)
+
+// HistoryEntry 保存某一天或某个小时的下载统计
+type HistoryEntry struct {
+	Time     string `json:"time"` // 按天: "2006-01-02"，按小时: "2006-01-02 15"
+	Bytes    int64  `json:"bytes"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+	RX       int64  `json:"rx,omitempty"` // 比例模式监控的网卡接收字节数
+	TX       int64  `json:"tx,omitempty"` // 比例模式监控的网卡发送字节数
+}
+
+// history 是持久化到 history.json 的历史数据
+type history struct {
+	Daily  map[string]*HistoryEntry `json:"daily"`
+	Hourly map[string]*HistoryEntry `json:"hourly"`
+}
+
+const (
+	dayLayout  = "2006-01-02"
+	hourLayout = "2006-01-02 15"
+
+	// 单次查询允许的最大范围
+	maxHistoryDays  = 366
+	maxHistoryHours = 31 * 24
+
+	// historySaveInterval 是下载过程中历史文件的最短保存间隔
+	// 历史文件比统计文件大得多，不随每次统计保存一起重写
+	historySaveInterval = 5 * time.Minute
+)
+
+var (
+	appHistory      = newHistory()
+	historyFile     = "conf/history.json"
+	lastHistorySave time.Time
+)
+
+func newHistory() history {
+	return history{
+		Daily:  make(map[string]*HistoryEntry),
+		Hourly: make(map[string]*HistoryEntry),
+	}
+}
+
+// entries 返回 t 所在的天和小时对应的记录，不存在时创建，调用方需持有 stateLock
+func (h *history) entries(t time.Time) (*HistoryEntry, *HistoryEntry) {
+	day := t.Format(dayLayout)
+	hour := t.Format(hourLayout)
+	if h.Daily[day] == nil {
+		h.Daily[day] = &HistoryEntry{Time: day}
+	}
+	if h.Hourly[hour] == nil {
+		h.Hourly[hour] = &HistoryEntry{Time: hour}
+	}
+	return h.Daily[day], h.Hourly[hour]
+}
+
+// addHistoryBytes 将下载量计入当前的天和小时，调用方需持有 stateLock
+func addHistoryBytes(n int64) {
+	daily, hourly := appHistory.entries(config.Now())
+	daily.Bytes += n
+	hourly.Bytes += n
+}
+
+// RecordRun 记录一次下载任务的结束，手动停止不算失败
+func RecordRun(success bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	daily, hourly := appHistory.entries(config.Now())
+	daily.Runs++
+	hourly.Runs++
+	if success {
+		appStats.RunsSucceeded++
+	} else {
+		appStats.RunsFailed++
+		daily.Failures++
+		hourly.Failures++
+	}
+	saveStats()
+	saveHistory()
+}
+
+// GetHistory 返回 [from, to] 日期范围内按天或按小时的统计，没有数据的时间段补零
+func GetHistory(from, to time.Time, hourly bool) []HistoryEntry {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location()).AddDate(0, 0, 1)
+
+	var result []HistoryEntry
+	if hourly {
+		for t := from; t.Before(end) && len(result) < maxHistoryHours; t = t.Add(time.Hour) {
+			result = append(result, historyAt(appHistory.Hourly, t.Format(hourLayout)))
+		}
+	} else {
+		for t := from; t.Before(end) && len(result) < maxHistoryDays; t = t.AddDate(0, 0, 1) {
+			result = append(result, historyAt(appHistory.Daily, t.Format(dayLayout)))
+		}
+	}
+	return result
+}
+
+func historyAt(m map[string]*HistoryEntry, key string) HistoryEntry {
+	if e, ok := m[key]; ok {
+		return *e
+	}
+	return HistoryEntry{Time: key}
+}
+
+// pruneHistory 删除超过保留期限的记录，调用方需持有 stateLock
+// 按天的记录保留 HistoryMonths 个月，按小时的记录只保留可以查询到的 maxHistoryHours
+func pruneHistory() {
+	months := config.GetConfig().HistoryMonths
+	if months <= 0 {
+		months = 12
+	}
+	now := config.Now()
+	cutoff := now.AddDate(0, -months, 0).Format(dayLayout)
+	// 日期格式的字符串可以直接按字典序比较
+	for k := range appHistory.Daily {
+		if k < cutoff {
+			delete(appHistory.Daily, k)
+		}
+	}
+	hourCutoff := now.Add(-maxHistoryHours * time.Hour).Format(dayLayout)
+	for k := range appHistory.Hourly {
+		if k < hourCutoff {
+			delete(appHistory.Hourly, k)
+		}
+	}
+}
+
+// --- 持久化 ---
+
+func LoadHistory() error {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	file, err := os.Open(historyFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	h := newHistory()
+	if err := json.NewDecoder(file).Decode(&h); err != nil {
+		return err
+	}
+	if h.Daily == nil {
+		h.Daily = make(map[string]*HistoryEntry)
+	}
+	if h.Hourly == nil {
+		h.Hourly = make(map[string]*HistoryEntry)
+	}
+	appHistory = h
+	pruneHistory()
+	return nil
+}
+
+// saveHistoryIfDue 距上次保存超过 historySaveInterval 时保存历史，调用方需持有 stateLock
+func saveHistoryIfDue() error {
+	if time.Since(lastHistorySave) < historySaveInterval {
+		return nil
+	}
+	return saveHistory()
+}
+
+// saveHistory 立即保存历史，调用方需持有 stateLock
+func saveHistory() error {
+	lastHistorySave = time.Now()
+	file, err := os.Create(historyFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(appHistory)
+}
@@ -0,0 +1,149 @@
+package docker
+
+import "docker-cycler/pkg/config"
+
+// InterfaceTraffic 保存单个网卡的收发字节数
+type InterfaceTraffic struct {
+	DailyRX   int64 `json:"daily_rx"`
+	DailyTX   int64 `json:"daily_tx"`
+	MonthlyRX int64 `json:"monthly_rx"` // 当前计费周期
+	MonthlyTX int64 `json:"monthly_tx"`
+	TotalRX   int64 `json:"total_rx"` // 开始监控以来的累计值，不会被重置
+	TotalTX   int64 `json:"total_tx"`
+}
+
+// TrafficDelta 是网卡在两次采样之间的收发字节数
+type TrafficDelta struct {
+	RX int64
+	TX int64
+}
+
+// selfSinceSample 是上次网卡采样之后本程序的下载量，尚未反映在网卡统计中，受 stateLock 保护
+var selfSinceSample int64
+
+// RecordInterfaceSample 将一次采样中各网卡的收发增量计入统计
+// 下载限制和比例模式使用的网卡都记录了增量后，此前本程序的下载量已反映在网卡统计中，清零 selfSinceSample
+// 刚开始监控的网卡只有基准值没有增量，这时继续保留，避免这段时间的下载量漏算
+func RecordInterfaceSample(deltas map[string]TrafficDelta) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	covered := true
+	for _, name := range accountedInterfaces(config.GetConfig()) {
+		if _, ok := deltas[name]; !ok {
+			covered = false
+		}
+	}
+	if covered {
+		selfSinceSample = 0
+	}
+	if len(deltas) == 0 {
+		return
+	}
+	for iface, d := range deltas {
+		recordInterfaceTraffic(iface, d.RX, d.TX)
+	}
+	saveStats()
+}
+
+// accountedInterfaces 返回需要计入 selfSinceSample 的网卡：按网卡流量限制时监控的网卡，以及比例模式的网卡
+// 没有这样的网卡时 selfSinceSample 不会被使用
+func accountedInterfaces(cfg config.Config) []string {
+	var names []string
+	if cfg.LimitSource == "interface_rx" || cfg.LimitSource == "interface_total" {
+		names = append(names, cfg.MonitorInterfaces...)
+	}
+	if cfg.RatioEnabled && cfg.RatioInterface != "" {
+		names = append(names, cfg.RatioInterface)
+	}
+	return names
+}
+
+// recordInterfaceTraffic 将网卡在两次采样之间的收发字节数计入统计，调用方需持有 stateLock
+// 比例模式监控的网卡同时计入历史，用于绘制下载:上传比
+func recordInterfaceTraffic(iface string, rx, tx int64) {
+	if appStats.Interfaces == nil {
+		appStats.Interfaces = make(map[string]InterfaceTraffic)
+	}
+	it := appStats.Interfaces[iface]
+	it.DailyRX += rx
+	it.DailyTX += tx
+	it.MonthlyRX += rx
+	it.MonthlyTX += tx
+	it.TotalRX += rx
+	it.TotalTX += tx
+	appStats.Interfaces[iface] = it
+
+	if cfg := config.GetConfig(); cfg.RatioEnabled && cfg.RatioInterface == iface {
+		daily, hourly := appHistory.entries(config.Now())
+		daily.RX += rx
+		daily.TX += tx
+		hourly.RX += rx
+		hourly.TX += tx
+	}
+}
+
+// GetInterfaceTraffic 返回各网卡统计的副本
+func GetInterfaceTraffic() map[string]InterfaceTraffic {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	result := make(map[string]InterfaceTraffic, len(appStats.Interfaces))
+	for k, v := range appStats.Interfaces {
+		result[k] = v
+	}
+	return result
+}
+
+// RatioDeficit 返回网卡今天为达到目标下载:上传比还需下载的字节数，已达到时返回 0
+// 上次采样之后本程序的下载量还没有反映在网卡统计中，同样计入已下载，避免补齐下载结束后重复补齐
+func RatioDeficit(iface string, target float64) int64 {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	it := appStats.Interfaces[iface]
+	deficit := int64(float64(it.DailyTX)*target) - it.DailyRX - selfSinceSample
+	if deficit < 0 {
+		return 0
+	}
+	return deficit
+}
+
+// resetInterfaceTraffic 清零所有网卡的每日或每月统计，调用方需持有 stateLock
+func resetInterfaceTraffic(daily, monthly bool) {
+	for k, it := range appStats.Interfaces {
+		if daily {
+			it.DailyRX, it.DailyTX = 0, 0
+		}
+		if monthly {
+			it.MonthlyRX, it.MonthlyTX = 0, 0
+		}
+		appStats.Interfaces[k] = it
+	}
+}
+
+// QuotaUsage 返回按 LimitSource 统计的今日和本周期已使用的流量
+func QuotaUsage() (daily, monthly int64) {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	return limitUsage(config.GetConfig())
+}
+
+// limitUsage 按配置的统计口径返回今日和本周期已使用的流量，调用方需持有 stateLock
+// "self" 只统计本程序的下载量，"interface_rx" 统计所选网卡的接收量，"interface_total" 统计所选网卡的收发总量
+// 网卡计数器每隔一段时间才采样一次，期间本程序的下载量同样计入，避免下载时大幅超出限制
+func limitUsage(cfg config.Config) (daily, monthly int64) {
+	switch cfg.LimitSource {
+	case "interface_rx", "interface_total":
+		daily, monthly = selfSinceSample, selfSinceSample
+		for _, name := range cfg.MonitorInterfaces {
+			it := appStats.Interfaces[name]
+			daily += it.DailyRX
+			monthly += it.MonthlyRX
+			if cfg.LimitSource == "interface_total" {
+				daily += it.DailyTX
+				monthly += it.MonthlyTX
+			}
+		}
+		return daily, monthly
+	default:
+		return appStats.DailyDownloadedBytes, appStats.MonthlyDownloadedBytes
+	}
+}
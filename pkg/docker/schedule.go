@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ScheduleState 是任务的调度状态，保存在文件中，重启后继续沿用
+type ScheduleState struct {
+	LastTriggered       time.Time `json:"last_triggered"`       // 上次按计划触发的时间
+	NextDue             time.Time `json:"next_due"`             // 下一次计划执行的时间，零值表示没有计划
+	ConsecutiveFailures int       `json:"consecutive_failures"` // 连续失败的次数，成功后清零
+}
+
+var (
+	// scheduleStates 按任务ID保存调度状态
+	scheduleStates = make(map[string]ScheduleState)
+	scheduleLock   sync.Mutex
+
+	// scheduleFile 保存任务ID到 ScheduleState 的映射
+	scheduleFile = "conf/schedule.json"
+)
+
+// LoadSchedule 从文件加载各任务的调度状态
+func LoadSchedule() error {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	file, err := os.Open(scheduleFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	states := make(map[string]ScheduleState)
+	if err := json.NewDecoder(file).Decode(&states); err != nil {
+		return err
+	}
+	scheduleStates = states
+	return nil
+}
+
+// saveSchedule 保存调度状态，调用方需持有 scheduleLock
+func saveSchedule() {
+	file, err := os.Create(scheduleFile)
+	if err != nil {
+		log.Printf("警告: 保存调度状态失败: %v", err)
+		return
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(scheduleStates); err != nil {
+		log.Printf("警告: 保存调度状态失败: %v", err)
+	}
+}
+
+// updateSchedule 修改任务的调度状态，有变化时保存到文件
+func updateSchedule(taskID string, update func(s *ScheduleState)) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	state := scheduleStates[taskID]
+	before := state
+	update(&state)
+	if state.LastTriggered.Equal(before.LastTriggered) && state.NextDue.Equal(before.NextDue) &&
+		state.ConsecutiveFailures == before.ConsecutiveFailures {
+		return
+	}
+	scheduleStates[taskID] = state
+	saveSchedule()
+}
+
+// GetScheduleState 返回任务的调度状态
+func GetScheduleState(taskID string) ScheduleState {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	return scheduleStates[taskID]
+}
+
+// LastTriggered 返回任务上次按计划触发的时间，从未触发过时返回零值
+func LastTriggered(taskID string) time.Time {
+	return GetScheduleState(taskID).LastTriggered
+}
+
+// SetLastTriggered 记录任务按计划触发的时间
+func SetLastTriggered(taskID string, t time.Time) {
+	updateSchedule(taskID, func(s *ScheduleState) {
+		s.LastTriggered = t
+	})
+}
+
+// SetNextDue 记录任务下一次计划执行的时间
+func SetNextDue(taskID string, t time.Time) {
+	updateSchedule(taskID, func(s *ScheduleState) {
+		s.NextDue = t
+	})
+}
+
+// RecordTaskResult 记录任务一次下载的结果，用于统计连续失败的次数
+func RecordTaskResult(taskID string, success bool) {
+	updateSchedule(taskID, func(s *ScheduleState) {
+		if success {
+			s.ConsecutiveFailures = 0
+		} else {
+			s.ConsecutiveFailures++
+		}
+	})
+}
+
+// forgetSchedule 删除已删除任务的调度状态
+func forgetSchedule(taskID string) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	if _, ok := scheduleStates[taskID]; !ok {
+		return
+	}
+	delete(scheduleStates, taskID)
+	saveSchedule()
+}
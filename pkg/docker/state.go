@@ -1,7 +1,6 @@
 package docker
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -14,21 +13,59 @@ import (
 
 // DownloadProgress 保存当前下载的状态
 type DownloadProgress struct {
-	Percent int    `json:"percent"`
-	Speed   int    `json:"speed"` // KB/s
-	Size    int    `json:"size"`  // KB
-	Status  string `json:"status"`
+	Percent     int                  `json:"percent"`
+	Speed       int                  `json:"speed"` // KB/s，所有连接的总速度
+	Size        int                  `json:"size"`  // KB
+	Status      string               `json:"status"`
+	Connections []ConnectionProgress `json:"connections,omitempty"` // 多连接下载时每个连接的状态
+}
+
+// ConnectionProgress 保存单个下载连接的状态
+type ConnectionProgress struct {
+	ID    int `json:"id"`
+	Speed int `json:"speed"` // KB/s
+	Size  int `json:"size"`  // 该连接已下载的 KB
 }
 
 // Stats 保存下载统计信息
 type Stats struct {
-	LastDownload        string     `json:"last_download"`
-	LastFile            string     `json:"last_file"`
-	Message             string     `json:"message"`
-	DailyDownloadedMB   int        `json:"daily_downloaded_mb"`
-	MonthlyDownloadedMB int        `json:"monthly_downloaded_mb"`
-	LastStatDate        string     `json:"last_stat_date"`   // 格式: "2006-01-02"
-	LastStatMonth       string     `json:"last_stat_month"`  // 格式: "2006-01"
+	LastDownload           string                      `json:"last_download"`
+	LastFile               string                      `json:"last_file"`
+	LastURL                string                      `json:"last_url"`
+	Message                string                      `json:"message"`
+	DailyDownloadedBytes   int64                       `json:"daily_downloaded_bytes"`
+	MonthlyDownloadedBytes int64                       `json:"monthly_downloaded_bytes"`        // 当前计费周期的下载量
+	TotalDownloadedBytes   int64                       `json:"total_downloaded_bytes"`          // 累计下载量，不会被重置
+	RunsSucceeded          int64                       `json:"runs_succeeded"`                  // 累计成功（含手动停止）的下载次数
+	RunsFailed             int64                       `json:"runs_failed"`                     // 累计失败的下载次数
+	DailyDownloadedMB      int                         `json:"daily_downloaded_mb,omitempty"`   // 已废弃，仅用于迁移旧版本的统计文件
+	MonthlyDownloadedMB    int                         `json:"monthly_downloaded_mb,omitempty"` // 已废弃，仅用于迁移旧版本的统计文件
+	LastStatDate           string                      `json:"last_stat_date"`                  // 格式: "2006-01-02"
+	LastStatMonth          string                      `json:"last_stat_month"`                 // 当前计费周期的开始日期，格式: "2006-01-02"
+	BillingDay             int                         `json:"billing_day,omitempty"`           // 计算当前计费周期时使用的计费日，0 表示与配置相同
+	URLStats               map[string]URLStat          `json:"url_stats"`                       // 按下载地址统计的历史结果
+	LastAttempts           []Attempt                   `json:"last_attempts"`                   // 最近一次下载的重试记录
+	Interfaces             map[string]InterfaceTraffic `json:"interfaces"`                      // 按网卡统计的收发字节数
+}
+
+// Attempt 记录一次失败后的重试
+type Attempt struct {
+	Time  string `json:"time"`
+	Label string `json:"label"` // 如 "重试 2/5" 或 "连接#2 重试 1/3"
+	Error string `json:"error"`
+}
+
+// maxAttempts 是保留的重试记录条数
+const maxAttempts = 20
+
+// URLStat 保存单个下载地址的使用记录
+type URLStat struct {
+	Runs                int       `json:"runs"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastSpeedKB         int       `json:"last_speed_kb"` // 最近一次成功下载的平均速度
+	LastUsed            time.Time `json:"last_used"`
+	LastFailure         time.Time `json:"last_failure"`
 }
 
 // AppStatus 代表发送到前端的应用程序的整体状态
@@ -37,26 +74,26 @@ type AppStatus struct {
 	Stats       Stats         `json:"stats"`
 	TaskEnabled bool          `json:"task_enabled"`
 	TaskStatus  string        `json:"task_status"`
+	NextRunAt   *time.Time    `json:"next_run_at"` // 主任务下一次计划执行的时间，没有计划时为 null
 }
 
 var (
 	// 全局状态变量
-	appStats        Stats
-	currentProgress DownloadProgress
-	taskStatus      = "空闲" // "空闲", "下载中", "失败", "已停止"
-	downloadDir     string
+	appStats    Stats
+	downloadDir string
 
 	// 用于线程安全访问的互斥锁
 	stateLock    sync.RWMutex
 	progressLock sync.RWMutex
 
-	// 用于通知下载停止的上下文和取消函数
-	downloadCtx    context.Context
-	downloadCancel context.CancelFunc
-
 	statsFile = "conf/stats.json"
+
+	lastStatsSave time.Time
 )
 
+// statsSaveInterval 是下载过程中统计文件的最短保存间隔
+const statsSaveInterval = 5 * time.Second
+
 // InitState 从文件加载初始状态
 func InitState() {
 	if err := os.MkdirAll("conf", 0755); err != nil {
@@ -74,6 +111,11 @@ func InitState() {
 		log.Printf("警告: 创建下载目录 '%s' 失败: %v", downloadDir, err)
 	}
 
+	// 历史统计需要先于统计文件加载，否则重置统计时会覆盖历史文件
+	if err := LoadHistory(); err != nil && !os.IsNotExist(err) {
+		log.Printf("警告: 加载历史统计失败: %v", err)
+	}
+
 	if err := LoadStats(); err != nil {
 		log.Printf("警告: 加载统计文件失败: %v。将使用初始统计。", err)
 		ResetStats(true, true) // 如果加载失败，重置统计
@@ -83,130 +125,287 @@ func InitState() {
 		CheckAndResetStats()
 	}
 
-	// 初始化第一个下载上下文
-	NewDownloadContext()
-}
-
-// NewDownloadContext 创建一个新的可取消的上下文用于下载
-func NewDownloadContext() {
-	stateLock.Lock()
-	defer stateLock.Unlock()
-	if downloadCancel != nil {
-		downloadCancel() // 以防万一，取消之前的上下文
+	if err := LoadSchedule(); err != nil && !os.IsNotExist(err) {
+		log.Printf("警告: 加载计划记录失败: %v", err)
 	}
-	downloadCtx, downloadCancel = context.WithCancel(context.Background())
 }
 
-// GetDownloadContext 返回当前的下载上下文
-func GetDownloadContext() context.Context {
+// --- 状态和统计管理 ---
+
+func GetAppStatus() AppStatus {
 	stateLock.RLock()
 	defer stateLock.RUnlock()
-	return downloadCtx
+	cfg := config.GetConfig()
+	// 复制统计中的 map，避免序列化时与后台更新并发读写
+	stats := appStats
+	stats.URLStats = make(map[string]URLStat, len(appStats.URLStats))
+	for k, v := range appStats.URLStats {
+		stats.URLStats[k] = v
+	}
+	stats.Interfaces = make(map[string]InterfaceTraffic, len(appStats.Interfaces))
+	for k, v := range appStats.Interfaces {
+		stats.Interfaces[k] = v
+	}
+	// 使用配置文件中的设置，而不是内部变量
+	return AppStatus{
+		Config:      cfg,
+		Stats:       stats,
+		TaskEnabled: cfg.TaskEnabled,
+		TaskStatus:  mainTaskStatus(),
+		NextRunAt:   nextRunAt(cfg),
+	}
 }
 
-// --- 进度管理 ---
-
-func SetProgress(percent, speed, size int, status string) {
-	progressLock.Lock()
-	defer progressLock.Unlock()
-	currentProgress = DownloadProgress{
-		Percent: percent,
-		Speed:   speed,
-		Size:    size,
-		Status:  status,
+// nextRunAt 返回启用中的主任务下一次计划执行的时间
+func nextRunAt(cfg config.Config) *time.Time {
+	next := GetScheduleState(config.MainTaskID).NextDue
+	if !cfg.TaskEnabled || next.IsZero() {
+		return nil
 	}
+	return &next
 }
 
-func GetProgress() DownloadProgress {
-	progressLock.RLock()
-	defer progressLock.RUnlock()
-	return currentProgress
+func UpdateMessage(format string, args ...interface{}) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	appStats.Message = fmt.Sprintf(format, args...)
+	log.Println(appStats.Message)
 }
 
-// --- 状态和统计管理 ---
-
-func SetTaskStatus(status string) {
+// AddDownloadStats 在下载过程中实时按字节累加下载量，中断的下载同样会被计入
+// 为避免频繁写盘，统计文件最多每隔 statsSaveInterval 保存一次
+func AddDownloadStats(bytesDownloaded int) {
 	stateLock.Lock()
 	defer stateLock.Unlock()
-	taskStatus = status
+	n := int64(bytesDownloaded)
+	appStats.DailyDownloadedBytes += n
+	appStats.MonthlyDownloadedBytes += n
+	appStats.TotalDownloadedBytes += n
+	selfSinceSample += n
+	addHistoryBytes(n)
+	if time.Since(lastStatsSave) >= statsSaveInterval {
+		saveStats()
+	}
 }
 
-func GetTaskStatus() string {
+// RemainingQuota 返回当前剩余的下载额度（字节）以及达到上限时的提示
+// 已用量按 LimitSource 统计，reason 为空表示没有启用任何限制
+func RemainingQuota() (remaining int64, reason string) {
 	stateLock.RLock()
 	defer stateLock.RUnlock()
-	return taskStatus
+	cfg := config.GetConfig()
+	dailyUsed, monthlyUsed := limitUsage(cfg)
+	remaining = -1
+	if cfg.DailyLimitEnabled {
+		remaining = int64(cfg.LimitMB)*1024*1024 - dailyUsed
+		reason = "今日下载量已达上限"
+	}
+	if cfg.MonthlyLimitEnabled {
+		monthly := int64(cfg.MonthlyLimitMB)*1024*1024 - monthlyUsed
+		if reason == "" || monthly < remaining {
+			remaining = monthly
+			reason = "本月下载量已达上限"
+		}
+	}
+	// 匀速模式的每日目标同样视为当天的额度，完成后停止下载
+	if target := cfg.PacingTargetBytes(); target > 0 {
+		left := target - appStats.DailyDownloadedBytes
+		if reason == "" || left < remaining {
+			remaining = left
+			reason = "今日目标下载量已完成"
+		}
+	}
+	if reason == "" {
+		return 0, ""
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, reason
 }
 
-func GetAppStatus() AppStatus {
+// DailyDownloadedBytes 返回今天已下载的字节数
+func DailyDownloadedBytes() int64 {
 	stateLock.RLock()
 	defer stateLock.RUnlock()
-	cfg := config.GetConfig()
-	// 使用配置文件中的设置，而不是内部变量
-	return AppStatus{
-		Config:      cfg,
-		Stats:       appStats,
-		TaskEnabled: cfg.TaskEnabled,
-		TaskStatus:  taskStatus,
+	return appStats.DailyDownloadedBytes
+}
+
+// QuotaExhausted 判断下载额度是否已用完，返回提示信息
+func QuotaExhausted() (string, bool) {
+	remaining, reason := RemainingQuota()
+	if reason != "" && remaining == 0 {
+		return reason, true
 	}
+	return "", false
 }
 
-func UpdateMessage(format string, args ...interface{}) {
+func UpdateLastDownloadInfo(filename string, success bool) {
 	stateLock.Lock()
 	defer stateLock.Unlock()
-	appStats.Message = fmt.Sprintf(format, args...)
-	log.Println(appStats.Message)
+	if success {
+		appStats.LastDownload = config.Now().Format("2006-01-02 15:04:05")
+		appStats.LastFile = filename
+	}
+	saveStats()
 }
 
-func AddDownloadStats(bytesDownloaded int) {
+// RecordAttempt 记录一次重试及导致重试的错误
+func RecordAttempt(label string, err error) {
 	stateLock.Lock()
 	defer stateLock.Unlock()
-	mbDownloaded := bytesDownloaded / 1024 / 1024
-	if mbDownloaded > 0 {
-		appStats.DailyDownloadedMB += mbDownloaded
-		appStats.MonthlyDownloadedMB += mbDownloaded
-		saveStats()
+	appStats.LastAttempts = append(appStats.LastAttempts, Attempt{
+		Time:  config.Now().Format("2006-01-02 15:04:05"),
+		Label: label,
+		Error: err.Error(),
+	})
+	if len(appStats.LastAttempts) > maxAttempts {
+		appStats.LastAttempts = appStats.LastAttempts[len(appStats.LastAttempts)-maxAttempts:]
 	}
 }
 
-func UpdateLastDownloadInfo(filename string, success bool) {
+// ClearAttempts 清空重试记录，在每次下载开始时调用
+func ClearAttempts() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	appStats.LastAttempts = nil
+}
+
+// RecordURLResult 记录一次使用某个下载地址的结果
+func RecordURLResult(urlStr string, speedKB int, success bool) {
 	stateLock.Lock()
 	defer stateLock.Unlock()
+	if appStats.URLStats == nil {
+		appStats.URLStats = make(map[string]URLStat)
+	}
+	st := appStats.URLStats[urlStr]
+	st.Runs++
+	st.LastUsed = time.Now()
 	if success {
-		appStats.LastDownload = time.Now().Format("2006-01-02 15:04:05")
-		appStats.LastFile = filename
+		st.ConsecutiveFailures = 0
+		st.LastSpeedKB = speedKB
+	} else {
+		st.Failures++
+		st.ConsecutiveFailures++
+		st.LastFailure = st.LastUsed
 	}
+	appStats.URLStats[urlStr] = st
+	appStats.LastURL = urlStr
 	saveStats()
 }
 
-// CheckAndResetStats 检查是否需要重置每日或每月统计
+// GetURLStats 返回各下载地址统计的副本
+func GetURLStats() map[string]URLStat {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	result := make(map[string]URLStat, len(appStats.URLStats))
+	for k, v := range appStats.URLStats {
+		result[k] = v
+	}
+	return result
+}
+
+// CheckAndResetStats 检查是否需要重置每日统计或切换计费周期
 func CheckAndResetStats() {
 	stateLock.Lock()
 	defer stateLock.Unlock()
-	now := time.Now()
+	now := config.Now()
 	currentDate := now.Format("2006-01-02")
-	currentMonth := now.Format("2006-01")
-	
-	resetDaily := appStats.LastStatDate != currentDate
-	resetMonthly := appStats.LastStatMonth != currentMonth
-	
-	if resetDaily || resetMonthly {
-		ResetStats(resetDaily, resetMonthly)
+	billingDay := config.GetConfig().BillingDay
+	currentCycle := billingCycleStart(now, billingDay).Format("2006-01-02")
+
+	if currentCycle != appStats.LastStatMonth {
+		switchBillingCycle(now, billingDay)
+	}
+	if appStats.LastStatDate != currentDate {
+		ResetStats(true, false)
 	}
 }
 
 func ResetStats(daily, monthly bool) {
-	now := time.Now()
+	now := config.Now()
 	if daily {
-		appStats.DailyDownloadedMB = 0
+		appStats.DailyDownloadedBytes = 0
 		appStats.LastStatDate = now.Format("2006-01-02")
 		log.Printf("每日统计已重置，新日期: %s", appStats.LastStatDate)
+		pruneHistory()
 	}
 	if monthly {
-		appStats.MonthlyDownloadedMB = 0
-		appStats.LastStatMonth = now.Format("2006-01")
-		log.Printf("每月统计已重置，新月份: %s", appStats.LastStatMonth)
+		billingDay := config.GetConfig().BillingDay
+		appStats.MonthlyDownloadedBytes = 0
+		appStats.LastStatMonth = billingCycleStart(now, billingDay).Format("2006-01-02")
+		appStats.BillingDay = billingDay
+		log.Printf("每月统计已重置，新计费周期开始于: %s", appStats.LastStatMonth)
 	}
+	resetInterfaceTraffic(daily, monthly)
 	saveStats()
+	if daily {
+		saveHistory() // 保存清理过期记录后的历史
+	}
+}
+
+// switchBillingCycle 切换到 now 所在的计费周期，调用方需持有 stateLock
+// 进入新周期和修改计费日都会走到这里：本程序的下载量按每日历史重新累加，修改计费日不会丢失新周期内已有的下载量
+// 网卡的周期统计无法按天拆分，只在原来的周期结束后清零
+func switchBillingCycle(now time.Time, billingDay int) {
+	start := billingCycleStart(now, billingDay)
+	var used int64
+	for d := start; !d.After(now); d = d.AddDate(0, 0, 1) {
+		if e, ok := appHistory.Daily[d.Format(dayLayout)]; ok {
+			used += e.Bytes
+		}
+	}
+
+	previousDay := appStats.BillingDay
+	if previousDay == 0 {
+		previousDay = billingDay
+	}
+	ended := true
+	if previous, err := time.ParseInLocation("2006-01-02", appStats.LastStatMonth, now.Location()); err == nil {
+		ended = !now.Before(billingCycleEnd(previous, previousDay))
+	}
+	if ended {
+		resetInterfaceTraffic(false, true)
+	}
+
+	appStats.MonthlyDownloadedBytes = used
+	appStats.LastStatMonth = start.Format("2006-01-02")
+	appStats.BillingDay = billingDay
+	log.Printf("计费周期开始于: %s，本周期已下载 %d 字节", appStats.LastStatMonth, used)
+	saveStats()
+}
+
+// billingCycleEnd 返回从 start 开始的计费周期的结束时间，即下一个周期的开始
+func billingCycleEnd(start time.Time, billingDay int) time.Time {
+	if billingDay <= 0 {
+		billingDay = 1
+	}
+	next := time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, start.Location())
+	return time.Date(next.Year(), next.Month(), clampDay(next.Year(), next.Month(), billingDay), 0, 0, 0, 0, start.Location())
+}
+
+// billingCycleStart 返回 t 所在计费周期的开始日期
+// billingDay 超过当月天数时按当月最后一天计算，<= 0 视为每月 1 日
+func billingCycleStart(t time.Time, billingDay int) time.Time {
+	if billingDay <= 0 {
+		billingDay = 1
+	}
+	year, month := t.Year(), t.Month()
+	if t.Day() < clampDay(year, month, billingDay) {
+		// 还没到本月的计费日，周期从上个月开始
+		prev := time.Date(year, month-1, 1, 0, 0, 0, 0, t.Location())
+		year, month = prev.Year(), prev.Month()
+	}
+	return time.Date(year, month, clampDay(year, month, billingDay), 0, 0, 0, 0, t.Location())
+}
+
+// clampDay 将日期限制在该月的天数以内
+func clampDay(year int, month time.Month, day int) int {
+	days := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > days {
+		return days
+	}
+	return day
 }
 
 // --- 持久化 ---
@@ -222,21 +421,38 @@ func LoadStats() error {
 	decoder := json.NewDecoder(file)
 	err = decoder.Decode(&appStats)
 	if err == nil {
-		now := time.Now()
+		now := config.Now()
 		// 如果没有保存过日期信息，初始化为当前日期
 		if appStats.LastStatDate == "" {
 			appStats.LastStatDate = now.Format("2006-01-02")
 		}
+		currentCycle := billingCycleStart(now, config.GetConfig().BillingDay).Format("2006-01-02")
 		if appStats.LastStatMonth == "" {
-			appStats.LastStatMonth = now.Format("2006-01")
+			appStats.LastStatMonth = currentCycle
+		}
+		// 旧版本按自然月统计（格式 "2006-01"），仍是本月时沿用当前计费周期，避免清空本月数据
+		if appStats.LastStatMonth == now.Format("2006-01") {
+			appStats.LastStatMonth = currentCycle
 		}
-		log.Printf("统计加载完成，最后统计日期: %s, 最后统计月份: %s", 
+		// 旧版本按 MB 统计，迁移为字节
+		if appStats.DailyDownloadedMB > 0 || appStats.MonthlyDownloadedMB > 0 {
+			appStats.DailyDownloadedBytes += int64(appStats.DailyDownloadedMB) * 1024 * 1024
+			appStats.MonthlyDownloadedBytes += int64(appStats.MonthlyDownloadedMB) * 1024 * 1024
+			if appStats.TotalDownloadedBytes < appStats.MonthlyDownloadedBytes {
+				appStats.TotalDownloadedBytes = appStats.MonthlyDownloadedBytes
+			}
+			appStats.DailyDownloadedMB = 0
+			appStats.MonthlyDownloadedMB = 0
+			saveStats()
+		}
+		log.Printf("统计加载完成，最后统计日期: %s, 计费周期开始于: %s",
 			appStats.LastStatDate, appStats.LastStatMonth)
 	}
 	return err
 }
 
 func saveStats() error {
+	lastStatsSave = time.Now()
 	file, err := os.Create(statsFile)
 	if err != nil {
 		return err
@@ -244,5 +460,8 @@ func saveStats() error {
 	defer file.Close()
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(appStats)
+	if err := encoder.Encode(appStats); err != nil {
+		return err
+	}
+	return saveHistoryIfDue()
 }
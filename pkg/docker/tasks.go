@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+
+	"docker-cycler/pkg/config"
+)
+
+// TaskRuntime 是单个任务的运行状态
+type TaskRuntime struct {
+	Status   string           `json:"status"` // "空闲", "排队中", "下载中", "已暂停", "已跳过", "失败", "已停止"
+	Progress DownloadProgress `json:"progress"`
+	Schedule ScheduleState    `json:"schedule"`
+}
+
+var (
+	// 按任务ID保存的状态、进度和取消函数
+	taskStatuses = make(map[string]string)             // 由 stateLock 保护
+	taskCancels  = make(map[string]context.CancelFunc) // 由 stateLock 保护
+	taskProgress = make(map[string]DownloadProgress)   // 由 progressLock 保护
+)
+
+// NewDownloadContext 为任务创建一个新的可取消的上下文用于下载，并取消该任务之前的下载
+func NewDownloadContext(taskID string) context.Context {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if cancel := taskCancels[taskID]; cancel != nil {
+		cancel() // 以防万一，取消之前的上下文
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	taskCancels[taskID] = cancel
+	return ctx
+}
+
+// StopDownload 取消任务当前的下载
+func StopDownload(taskID string) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if cancel := taskCancels[taskID]; cancel != nil {
+		cancel()
+		delete(taskCancels, taskID)
+	}
+}
+
+// StopAllDownloads 取消所有任务的下载
+func StopAllDownloads() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	for id, cancel := range taskCancels {
+		cancel()
+		delete(taskCancels, id)
+	}
+}
+
+// --- 进度管理 ---
+
+func SetProgress(taskID string, percent, speed, size int, status string, conns ...ConnectionProgress) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	taskProgress[taskID] = DownloadProgress{
+		Percent:     percent,
+		Speed:       speed,
+		Size:        size,
+		Status:      status,
+		Connections: conns,
+	}
+}
+
+func GetProgress(taskID string) DownloadProgress {
+	progressLock.RLock()
+	defer progressLock.RUnlock()
+	return taskProgress[taskID]
+}
+
+// --- 任务状态 ---
+
+func SetTaskStatus(taskID, status string) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	taskStatuses[taskID] = status
+}
+
+func GetTaskStatus(taskID string) string {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	return taskStatusLocked(taskID)
+}
+
+// taskStatusLocked 返回任务状态，从未运行过的任务为 "空闲"，调用方需持有 stateLock
+func taskStatusLocked(taskID string) string {
+	if status, ok := taskStatuses[taskID]; ok {
+		return status
+	}
+	return "空闲"
+}
+
+// TaskBusy 判断任务是否有进行中或排队中的下载，包括因时段或速度计划暂停的下载
+func TaskBusy(taskID string) bool {
+	status := GetTaskStatus(taskID)
+	return status == "下载中" || status == "已暂停" || status == "排队中"
+}
+
+// AnyDownloading 判断是否有任务正在下载
+func AnyDownloading() bool {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	for _, status := range taskStatuses {
+		if status == "下载中" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTaskRuntime 返回任务的运行状态和进度
+func GetTaskRuntime(taskID string) TaskRuntime {
+	return TaskRuntime{
+		Status:   GetTaskStatus(taskID),
+		Progress: GetProgress(taskID),
+		Schedule: GetScheduleState(taskID),
+	}
+}
+
+// ForgetTask 清除已删除任务的运行状态
+func ForgetTask(taskID string) {
+	StopDownload(taskID)
+	stateLock.Lock()
+	delete(taskStatuses, taskID)
+	stateLock.Unlock()
+	progressLock.Lock()
+	delete(taskProgress, taskID)
+	progressLock.Unlock()
+	forgetSchedule(taskID)
+}
+
+// mainTaskStatus 返回主任务的状态，调用方需持有 stateLock
+func mainTaskStatus() string {
+	return taskStatusLocked(config.MainTaskID)
+}
@@ -2,159 +2,353 @@ package downloader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"golang.org/x/time/rate"
+	"docker-cycler/pkg/config"
 	"docker-cycler/pkg/docker"
 )
 
-// rateLimitedReader 实现了限速的io.Reader
-type rateLimitedReader struct {
-	reader  io.Reader
-	limiter *rate.Limiter
-	ctx     context.Context
+// maxConnections 是允许的最大并发连接数
+const maxConnections = 16
+
+// ErrStopped 表示下载被手动停止
+var ErrStopped = errors.New("下载被手动停止")
+
+// Options 描述一次下载任务的参数
+type Options struct {
+	TaskID       string // 进度和状态归属的任务
+	URL          string
+	SpeedKB      int                 // 所有连接共享的总限速，0 表示不限速
+	SpeedProfile []int               // 每周速度计划，为 nil 时只使用 SpeedKB
+	Windows      []config.TimeWindow // 允许下载的时段，时段外暂停下载，为 nil 时不限制
+	PaceTarget   int64               // 匀速模式的每日目标下载量（字节），0 表示不启用
+	Humanize     *config.Humanize    // 拟人化的随机速度和停顿，为 nil 时不启用
+	Dir          string
+	Sink         bool // 丢弃模式：数据只计数不落盘
+	Connections  int  // 并发连接数，<=1 表示单连接
+	Retry        RetryPolicy
+	MaxBytes     int64         // 单次下载的字节上限，0 表示不限制
+	MaxDuration  time.Duration // 单次下载的时长上限，0 表示不限制
+}
+
+// transfer 保存一次下载中各连接共享的状态
+type transfer struct {
+	url      string
+	throttle *throttle   // 为 nil 时不限速
+	budget   *byteBudget // 为 nil 时不限制字节数
+	pw       *progressWriter
 }
 
-func (r *rateLimitedReader) Read(p []byte) (int, error) {
-	n, err := r.reader.Read(p)
-	if n > 0 && r.limiter != nil {
-		// 等待令牌
-		if err := r.limiter.WaitN(r.ctx, n); err != nil {
-			return n, err
+// segment 描述一个连接负责下载的内容
+// ranged 为 true 时只请求 [start, end] 区间，否则请求完整文件
+type segment struct {
+	id     int
+	start  int64
+	end    int64
+	ranged bool
+	file   *os.File // 为 nil 时数据直接丢弃
+	done   int64    // 已写入的字节数，用于断点续传
+	sized  bool     // 是否已将响应大小计入进度
+}
+
+// Write 将数据写入文件中该分段的当前位置
+func (s *segment) Write(p []byte) (int, error) {
+	if s.file != nil {
+		if _, err := s.file.WriteAt(p, s.start+s.done); err != nil {
+			return 0, err
 		}
 	}
-	return n, err
+	s.done += int64(len(p))
+	return len(p), nil
 }
 
-// progressWriter 是一个自定义的 io.Writer，用于跟踪下载进度和速度
-type progressWriter struct {
-	total      int64
-	size       int64
-	lastUpdate time.Time
-	lastBytes  int64
+// length 返回分段的总长度，非分段模式返回 -1
+func (s *segment) length() int64 {
+	if !s.ranged {
+		return -1
+	}
+	return s.end - s.start + 1
 }
 
-func (pw *progressWriter) Write(p []byte) (int, error) {
-	n := len(p)
-	pw.total += int64(n)
+// DownloadFileWithProgress 使用令牌桶算法进行限速，并提供精确的进度回调
+// 多连接时优先按 Range 分段下载同一文件，服务器不支持 Range 时改为多条独立的完整下载流
+func DownloadFileWithProgress(ctx context.Context, opts Options) (string, int, error) {
+
+	docker.ClearAttempts()
 
-	now := time.Now()
-	if now.Sub(pw.lastUpdate) > time.Second || pw.total == pw.size {
-		elapsed := now.Sub(pw.lastUpdate).Seconds()
-		if elapsed == 0 {
-			elapsed = 1 // 避免除以零
+	// 清除该任务之前的下载文件（丢弃模式不落盘，无需清理）
+	if !opts.Sink {
+		docker.CleanTaskCache(opts.Dir, opts.TaskID)
+	}
+
+	conns := opts.Connections
+	if conns < 1 {
+		conns = 1
+	}
+	if conns > maxConnections {
+		conns = maxConnections
+	}
+
+	// 多连接时先探测文件大小和 Range 支持情况
+	var size int64
+	ranged := false
+	if conns > 1 {
+		err := withRetry(ctx, opts.Retry, "探测", func() error {
+			var err error
+			size, ranged, err = probeRange(ctx, opts.URL)
+			return err
+		})
+		if err != nil {
+			docker.SetProgress(opts.TaskID, 0, 0, 0, "下载失败: "+err.Error())
+			return "", 0, err
 		}
-		speed := float64(pw.total-pw.lastBytes) / 1024 / elapsed
-
-		percent := 0
-		totalKB := int(pw.total / 1024)
-		if pw.size > 0 {
-			percent = int(float64(pw.total) * 100 / float64(pw.size))
-			docker.SetProgress(percent, int(speed), int(pw.size/1024), "下载中")
-		} else {
-			// 未知文件大小时，显示已下载的大小
-			docker.SetProgress(0, int(speed), totalKB, "下载中")
+		if size < int64(conns) {
+			ranged = false
 		}
+	}
 
-		pw.lastUpdate = now
-		pw.lastBytes = pw.total
+	// 文件名包含任务ID和纳秒时间，同时开始的任务不会写入同一个文件
+	base := docker.TaskFileName(opts.TaskID, time.Now())
+	filename := filepath.Join(opts.Dir, base)
+	if opts.Sink {
+		filename = base + " (已丢弃)"
 	}
 
-	return n, nil
-}
+	// 规划每个连接的下载内容及其输出
+	segments := make([]*segment, conns)
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	defer closeFiles()
 
-// downloadFileWithProgress 使用令牌桶算法进行限速，并提供精确的进度回调
-func DownloadFileWithProgress(ctx context.Context, urlStr string, speedKB int, downloadDir string) (string, int, error) {
+	var rangedFile *os.File
+	if ranged && !opts.Sink {
+		file, err := os.Create(filename)
+		if err != nil {
+			docker.SetProgress(opts.TaskID, 0, 0, 0, "创建文件失败")
+			return "", 0, err
+		}
+		files = append(files, file)
+		if err := file.Truncate(size); err != nil {
+			docker.SetProgress(opts.TaskID, 0, 0, 0, "创建文件失败")
+			return "", 0, err
+		}
+		rangedFile = file
+	}
 
-	// 清除缓存
-	docker.CleanCache()
+	partSize := size / int64(conns)
+	for i := range segments {
+		seg := &segment{id: i, end: -1}
+		if ranged {
+			seg.ranged = true
+			seg.start = int64(i) * partSize
+			seg.end = seg.start + partSize - 1
+			if i == conns-1 {
+				seg.end = size - 1
+			}
+			seg.file = rangedFile
+		} else if !opts.Sink {
+			name := filename
+			if conns > 1 {
+				name = fmt.Sprintf("%s_%d", filename, i+1)
+			}
+			file, err := os.Create(name)
+			if err != nil {
+				docker.SetProgress(opts.TaskID, 0, 0, 0, "创建文件失败")
+				return "", 0, err
+			}
+			files = append(files, file)
+			seg.file = file
+		}
+		segments[i] = seg
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
-	if err != nil {
-		return "", 0, err
+	// 初始化进度写入器，非分段模式下文件大小由各连接的响应累加
+	pw := newProgressWriter(opts.TaskID, conns)
+	if ranged {
+		pw.size = size
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		docker.SetProgress(0, 0, 0, "下载失败: "+err.Error())
-		return "", 0, err
+	// 所有连接共享同一个限速器，保证 SpeedKB 限制的是总速度
+	t := &transfer{
+		url:      opts.URL,
+		throttle: newThrottle(opts),
+		pw:       pw,
+	}
+	if opts.MaxBytes > 0 {
+		t.budget = &byteBudget{remaining: opts.MaxBytes}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
-		docker.SetProgress(0, 0, 0, err.Error())
-		return "", 0, err
+	docker.SetProgress(opts.TaskID, 0, 0, int(pw.size/1024), "下载中")
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// 跨越速度计划或允许时段的边界时实时调整限速，匀速模式下持续调整
+	go t.throttle.follow(runCtx, opts.TaskID)
+
+	if opts.MaxDuration > 0 {
+		timer := time.AfterFunc(opts.MaxDuration, func() {
+			cancel(errTimeLimit)
+		})
+		defer timer.Stop()
 	}
 
-	size := resp.ContentLength
-	if size < 0 {
-		size = 0 // 未知文件大小
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, seg := range segments {
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			label := ""
+			if conns > 1 {
+				label = fmt.Sprintf("连接#%d ", seg.id+1)
+			}
+			err := withRetry(runCtx, opts.Retry, label, func() error {
+				return t.fetchSegment(runCtx, seg)
+			})
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel(err) // 任一连接失败或达到上限时停止其他连接
+				})
+			}
+		}(seg)
 	}
-	filename := filepath.Join(downloadDir, fmt.Sprintf("file_%d", time.Now().Unix()))
-	out, err := os.Create(filename)
-	if err != nil {
-		docker.SetProgress(0, 0, 0, "创建文件失败")
-		return "", 0, err
+	wg.Wait()
+
+	total, size := pw.snapshot()
+	currentKB := int(total / 1024)
+	if size > 0 {
+		currentKB = int(size / 1024)
 	}
-	defer out.Close()
 
-	// 初始化进度写入器
-	pw := &progressWriter{size: size, lastUpdate: time.Now()}
+	// 达到单次上限属于正常结束
+	var limitErr *limitError
+	if errors.As(context.Cause(runCtx), &limitErr) {
+		docker.SetProgress(opts.TaskID, 100, 0, currentKB, "下载完成（"+limitErr.Error()+"）")
+		return filename, int(total), nil
+	}
 
-	// 设置读取器，根据是否限速进行包装
-	var reader io.Reader = resp.Body
-	if speedKB > 0 {
-		// 令牌桶：每秒产生 speedKB * 1024 个令牌，桶容量为 2 倍的每秒速率
-		limiter := rate.NewLimiter(rate.Limit(speedKB*1024), speedKB*1024*2)
-		reader = &rateLimitedReader{
-			reader:  resp.Body,
-			limiter: limiter,
-			ctx:     ctx,
+	if firstErr != nil {
+		// 检查是否是 context cancel 导致的错误
+		if ctx.Err() == context.Canceled {
+			docker.SetProgress(opts.TaskID, pw.Percent(), 0, currentKB, "已手动停止")
+			return filename, int(total), ErrStopped
 		}
+		docker.SetProgress(opts.TaskID, pw.Percent(), 0, currentKB, "下载失败: "+firstErr.Error())
+		return filename, int(total), firstErr
 	}
 
-	// 使用 MultiWriter 将数据同时写入文件和进度跟踪器
-	mw := io.MultiWriter(out, pw)
+	docker.SetProgress(opts.TaskID, 100, 0, currentKB, "下载完成")
+	return filename, int(total), nil
+}
 
-	// 开始下载
-	sizeKB := int(size / 1024)
-	if size == 0 {
-		sizeKB = 0 // 未知大小
+// fetchSegment 通过一个连接下载指定的内容，重试时从已写入的位置继续
+func (t *transfer) fetchSegment(ctx context.Context, seg *segment) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.url, nil)
+	if err != nil {
+		return err
+	}
+	if seg.ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.start+seg.done, seg.end))
+	} else if seg.done > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", seg.done))
 	}
-	docker.SetProgress(0, 0, sizeKB, "下载中")
-	_, err = io.Copy(mw, reader)
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		// 检查是否是 context cancel 导致的错误
-		currentKB := int(pw.total / 1024)
-		if size > 0 {
-			currentKB = int(size / 1024)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && req.Header.Get("Range") != "":
+		// 分段下载或断点续传
+	case resp.StatusCode == http.StatusOK && !seg.ranged:
+		if seg.done > 0 {
+			// 服务器不支持 Range，只能从头开始，之前写入的部分不再计入进度
+			docker.UpdateMessage("服务器不支持断点续传，从头重新下载")
+			t.pw.discard(seg.id, seg.done)
+			seg.done = 0
 		}
-		if err == context.Canceled {
-			docker.SetProgress(pw.Percent(), 0, currentKB, "已手动停止")
-			return filename, int(pw.total), fmt.Errorf("下载被手动停止")
+		if !seg.sized && resp.ContentLength > 0 {
+			t.pw.addSize(resp.ContentLength)
 		}
-		docker.SetProgress(pw.Percent(), 0, currentKB, "下载失败: "+err.Error())
-		return filename, int(pw.total), err
+		seg.sized = true
+	default:
+		return &statusError{code: resp.StatusCode}
 	}
 
-	finalKB := int(pw.total / 1024)
-	if size > 0 {
-		finalKB = int(size / 1024)
+	// 设置读取器，根据是否限量、限速进行包装
+	var reader io.Reader = &quotaReader{reader: resp.Body}
+	if t.budget != nil {
+		reader = &budgetReader{reader: reader, budget: t.budget}
+	}
+	if t.throttle != nil {
+		reader = &rateLimitedReader{
+			reader:   reader,
+			throttle: t.throttle,
+			ctx:      ctx,
+		}
+	}
+
+	// 使用 MultiWriter 将数据同时写入文件（丢弃模式下只计数）和进度跟踪器
+	if _, err := io.Copy(io.MultiWriter(seg, t.pw.conn(seg.id)), reader); err != nil {
+		return err
 	}
-	docker.SetProgress(100, 0, finalKB, "下载完成")
-	return filename, int(pw.total), nil
+	if n := seg.length(); n > 0 && seg.done < n {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
 }
 
-// Percent 计算当前下载百分比
-func (pw *progressWriter) Percent() int {
-	if pw.size <= 0 {
-		return 0
+// probeRange 通过请求第一个字节探测文件总大小以及服务器是否支持 Range
+func probeRange(ctx context.Context, urlStr string) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/12345
+		contentRange := resp.Header.Get("Content-Range")
+		if idx := strings.LastIndex(contentRange, "/"); idx >= 0 {
+			if total, err := strconv.ParseInt(contentRange[idx+1:], 10, 64); err == nil {
+				return total, true, nil
+			}
+		}
+		return 0, false, nil
+	case http.StatusOK:
+		size := resp.ContentLength
+		if size < 0 {
+			size = 0 // 未知文件大小
+		}
+		return size, false, nil
+	default:
+		return 0, false, &statusError{code: resp.StatusCode}
 	}
-	return int(float64(pw.total) * 100 / float64(pw.size))
 }
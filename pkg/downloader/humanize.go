@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/humanize"
+)
+
+// humanizeStep 是随机速度变化和检查随机停顿的间隔
+const humanizeStep = 15 * time.Second
+
+// humanizer 使下载速度在范围内随机变化，并不时随机停顿一会
+// 速度和停顿使用任务各自的随机序列，同一种子下与其他任务的下载互不影响
+type humanizer struct {
+	cfg  config.Humanize
+	rate *humanize.Source
+	idle *humanize.Source
+
+	mu        sync.Mutex
+	speed     int       // 当前的随机速度（KB/s），0 表示不限制
+	idleUntil time.Time // 本次停顿的结束时间
+	nextIdle  time.Time // 下一次停顿的开始时间，零值表示不停顿
+}
+
+// newHumanizer 根据拟人化参数创建任务的速度变化器，没有需要在下载过程中变化的参数时返回 nil
+func newHumanizer(h *config.Humanize, taskID string, now time.Time) *humanizer {
+	if h == nil || (h.RateMaxKB <= 0 && (h.IdleEveryMinutes <= 0 || h.IdleMaxSeconds <= 0)) {
+		return nil
+	}
+	hz := &humanizer{
+		cfg:  *h,
+		rate: humanize.Stream(h.Seed, taskID, humanize.PurposeRate),
+		idle: humanize.Stream(h.Seed, taskID, humanize.PurposeIdle),
+	}
+	if h.RateMaxKB > 0 {
+		hz.speed = int(hz.rate.Between(int64(max(h.RateMinKB, 1)), int64(h.RateMaxKB)))
+	}
+	hz.scheduleIdle(now)
+	return hz
+}
+
+// scheduleIdle 安排 from 之后的下一次停顿，间隔在平均值的 0.5 到 1.5 倍之间随机
+func (hz *humanizer) scheduleIdle(from time.Time) {
+	if hz.cfg.IdleEveryMinutes <= 0 || hz.cfg.IdleMaxSeconds <= 0 {
+		return
+	}
+	every := time.Duration(hz.cfg.IdleEveryMinutes) * time.Minute
+	hz.nextIdle = from.Add(every/2 + hz.idle.Duration(every))
+}
+
+// step 推进到 t 时刻：随机调整速度，到达停顿时间时开始新的停顿
+func (hz *humanizer) step(t time.Time) {
+	hz.mu.Lock()
+	defer hz.mu.Unlock()
+	if hz.cfg.RateMaxKB > 0 {
+		hz.speed = hz.rate.Wander(hz.speed, max(hz.cfg.RateMinKB, 1), hz.cfg.RateMaxKB)
+	}
+	if !hz.nextIdle.IsZero() && !t.Before(hz.nextIdle) {
+		idle := hz.idle.Between(int64(hz.cfg.IdleMinSeconds), int64(hz.cfg.IdleMaxSeconds))
+		hz.idleUntil = t.Add(time.Duration(idle) * time.Second)
+		hz.scheduleIdle(hz.idleUntil)
+	}
+}
+
+// at 返回 t 时刻的随机速度，以及是否处于停顿中
+func (hz *humanizer) at(t time.Time) (int, bool) {
+	hz.mu.Lock()
+	defer hz.mu.Unlock()
+	return hz.speed, t.Before(hz.idleUntil)
+}
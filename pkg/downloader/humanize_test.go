@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/humanize"
+)
+
+type humanSample struct {
+	rate   int
+	paused bool
+}
+
+// runHumanizer 模拟一次下载中速度变化器的 n 步，other 不为空时同时推进另一个任务的变化器
+func runHumanizer(h *config.Humanize, taskID, other string, n int) []humanSample {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hz := newHumanizer(h, taskID, start)
+	var ohz *humanizer
+	if other != "" {
+		ohz = newHumanizer(h, other, start)
+	}
+	var out []humanSample
+	for i := 1; i <= n; i++ {
+		t := start.Add(time.Duration(i) * humanizeStep)
+		if ohz != nil {
+			ohz.step(t)
+		}
+		hz.step(t)
+		rate, paused := hz.at(t)
+		out = append(out, humanSample{rate, paused})
+	}
+	return out
+}
+
+func TestHumanizerReproducible(t *testing.T) {
+	h := &config.Humanize{
+		Enabled:          true,
+		Seed:             2026,
+		RateMinKB:        100,
+		RateMaxKB:        1000,
+		IdleEveryMinutes: 2,
+		IdleMinSeconds:   10,
+		IdleMaxSeconds:   60,
+	}
+	humanize.Reset()
+	first := runHumanizer(h, "main", "", 200)
+
+	// 从头开始，与另一个任务同时下载
+	humanize.Reset()
+	second := runHumanizer(h, "main", "task_other", 200)
+
+	paused := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("第 %d 步: %+v != %+v", i+1, first[i], second[i])
+		}
+		if first[i].rate < h.RateMinKB || first[i].rate > h.RateMaxKB {
+			t.Fatalf("第 %d 步的速度 %d 超出范围", i+1, first[i].rate)
+		}
+		if first[i].paused {
+			paused++
+		}
+	}
+	if paused == 0 {
+		t.Error("50 分钟内应该至少停顿一次")
+	}
+}
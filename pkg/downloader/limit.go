@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"io"
+	"sync"
+
+	"docker-cycler/pkg/docker"
+)
+
+// limitError 表示下载因达到上限而提前结束，这种情况视为下载成功
+type limitError struct {
+	reason string
+}
+
+func (e *limitError) Error() string {
+	return e.reason
+}
+
+var (
+	errByteLimit = &limitError{reason: "已达单次下载量上限"}
+	errTimeLimit = &limitError{reason: "已达单次下载时长上限"}
+)
+
+// byteBudget 是多个连接共享的剩余可下载字节数
+type byteBudget struct {
+	mu        sync.Mutex
+	remaining int64
+}
+
+// take 申请最多 n 个字节的额度，返回实际获得的额度
+func (b *byteBudget) take(n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+	}
+	b.remaining -= int64(n)
+	return n
+}
+
+// giveBack 归还未使用的额度
+func (b *byteBudget) giveBack(n int) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining += int64(n)
+}
+
+// budgetReader 在额度用完后停止读取
+type budgetReader struct {
+	reader io.Reader
+	budget *byteBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	allowed := r.budget.take(len(p))
+	if allowed == 0 {
+		return 0, errByteLimit
+	}
+	n, err := r.reader.Read(p[:allowed])
+	r.budget.giveBack(allowed - n)
+	return n, err
+}
+
+// quotaReader 在每次读取前检查全局剩余额度（如每日下载量上限），额度用完时停止读取
+type quotaReader struct {
+	reader io.Reader
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	remaining, reason := docker.RemainingQuota()
+	if reason != "" {
+		if remaining == 0 {
+			return 0, &limitError{reason: reason}
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	return r.reader.Read(p)
+}
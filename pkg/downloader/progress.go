@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/docker"
+)
+
+// progressWriter 用于跟踪下载进度和速度，可被多个连接并发写入
+type progressWriter struct {
+	mu         sync.Mutex
+	task       string
+	total      int64
+	size       int64
+	lastUpdate time.Time
+	lastBytes  int64
+	conns      []connStat
+}
+
+// connStat 记录单个连接的下载量
+type connStat struct {
+	total     int64
+	lastBytes int64
+}
+
+// connWriter 是一个自定义的 io.Writer，将某个连接写入的字节计入 progressWriter
+type connWriter struct {
+	pw *progressWriter
+	id int
+}
+
+func (cw connWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	cw.pw.add(cw.id, int64(n))
+	// 实时计入下载统计，使额度检查能及时生效
+	docker.AddDownloadStats(n)
+	return n, nil
+}
+
+func newProgressWriter(task string, conns int) *progressWriter {
+	return &progressWriter{
+		task:       task,
+		lastUpdate: time.Now(),
+		conns:      make([]connStat, conns),
+	}
+}
+
+// conn 返回第 id 个连接使用的写入器
+func (pw *progressWriter) conn(id int) connWriter {
+	return connWriter{pw: pw, id: id}
+}
+
+// addSize 累加预期的下载总大小
+func (pw *progressWriter) addSize(n int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.size += n
+}
+
+func (pw *progressWriter) add(id int, n int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.total += n
+	pw.conns[id].total += n
+
+	now := time.Now()
+	if now.Sub(pw.lastUpdate) > time.Second || pw.total == pw.size {
+		pw.reportLocked(now)
+	}
+}
+
+// discard 从进度中减去连接重新下载时丢弃的字节数
+// 这些流量已经计入下载统计，只是不再属于下载的文件
+func (pw *progressWriter) discard(id int, n int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.total -= n
+	pw.lastBytes -= n
+	pw.conns[id].total -= n
+	pw.conns[id].lastBytes -= n
+}
+
+// reportLocked 计算总速度和各连接速度并更新全局进度，调用方需持有锁
+func (pw *progressWriter) reportLocked(now time.Time) {
+	elapsed := now.Sub(pw.lastUpdate).Seconds()
+	if elapsed == 0 {
+		elapsed = 1 // 避免除以零
+	}
+	speed := float64(pw.total-pw.lastBytes) / 1024 / elapsed
+
+	// 多连接时附带每个连接的速度
+	var conns []docker.ConnectionProgress
+	if len(pw.conns) > 1 {
+		conns = make([]docker.ConnectionProgress, len(pw.conns))
+		for i := range pw.conns {
+			c := &pw.conns[i]
+			conns[i] = docker.ConnectionProgress{
+				ID:    i + 1,
+				Speed: int(float64(c.total-c.lastBytes) / 1024 / elapsed),
+				Size:  int(c.total / 1024),
+			}
+			c.lastBytes = c.total
+		}
+	}
+
+	if pw.size > 0 {
+		docker.SetProgress(pw.task, pw.percentLocked(), int(speed), int(pw.size/1024), "下载中", conns...)
+	} else {
+		// 未知文件大小时，显示已下载的大小
+		docker.SetProgress(pw.task, 0, int(speed), int(pw.total/1024), "下载中", conns...)
+	}
+
+	pw.lastUpdate = now
+	pw.lastBytes = pw.total
+}
+
+// snapshot 返回已下载字节数和预期总大小
+func (pw *progressWriter) snapshot() (int64, int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.total, pw.size
+}
+
+// Percent 计算当前下载百分比
+func (pw *progressWriter) Percent() int {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.percentLocked()
+}
+
+func (pw *progressWriter) percentLocked() int {
+	if pw.size <= 0 {
+		return 0
+	}
+	return int(float64(pw.total) * 100 / float64(pw.size))
+}
@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"docker-cycler/pkg/docker"
+)
+
+// maxRetryDelay 是两次重试之间的最长等待时间
+const maxRetryDelay = 5 * time.Minute
+
+// RetryPolicy 描述下载失败后的重试策略
+type RetryPolicy struct {
+	Count int           // 最大重试次数，0 表示不重试
+	Delay time.Duration // 首次重试的基础等待时间，之后每次翻倍
+}
+
+// backoff 返回第 attempt 次重试前的等待时间（指数退避并加入随机抖动）
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// 在 [delay/2, delay] 之间随机，避免多个连接同时重试
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// statusError 表示服务器返回了非预期的HTTP状态码
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP状态码: %d", e.code)
+}
+
+// retryable 判断错误是否值得重试，客户端错误（如404）重试也不会成功
+func retryable(err error) bool {
+	var le *limitError
+	if errors.As(err, &le) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusRequestTimeout || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// withRetry 执行 fn，失败时按照策略等待后重试，直到成功、重试次数用尽或上下文被取消
+func withRetry(ctx context.Context, policy RetryPolicy, label string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt > policy.Count || !retryable(err) {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		docker.RecordAttempt(fmt.Sprintf("%s重试 %d/%d", label, attempt, policy.Count), err)
+		docker.UpdateMessage("%s重试 %d/%d（%s后）: %v", label, attempt, policy.Count, delay.Round(time.Second), err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+	"golang.org/x/time/rate"
+)
+
+// throttle 是所有连接共享的限速器，设置了速度计划、允许时段、匀速目标或拟人化时会随时间调整限速或暂停下载
+type throttle struct {
+	limiter *rate.Limiter
+	base    int                 // 任务自身的限速，0 表示不限速
+	profile []int               // 每周速度计划，为 nil 时始终使用 base
+	windows []config.TimeWindow // 允许下载的时段，为 nil 时不限制
+	target  int64               // 匀速模式的每日目标下载量，0 表示不启用
+	human   *humanizer          // 拟人化的随机速度和停顿，为 nil 时不启用
+
+	// mu 的读锁在等待令牌期间持有，保证调整令牌桶容量时没有正在进行的等待
+	mu     sync.RWMutex
+	speed  int           // 当前生效的限速，取值含义同速度计划
+	resume chan struct{} // 暂停期间为未关闭的通道，恢复时关闭
+}
+
+// newThrottle 根据下载参数创建限速器，都不限制时返回 nil
+func newThrottle(opts Options) *throttle {
+	human := newHumanizer(opts.Humanize, opts.TaskID, time.Now())
+	if opts.SpeedKB <= 0 && opts.SpeedProfile == nil && opts.Windows == nil && opts.PaceTarget <= 0 && human == nil {
+		return nil
+	}
+	th := &throttle{
+		limiter: rate.NewLimiter(rate.Inf, 0),
+		base:    opts.SpeedKB,
+		profile: opts.SpeedProfile,
+		windows: opts.Windows,
+		target:  opts.PaceTarget,
+		human:   human,
+		resume:  make(chan struct{}),
+	}
+	close(th.resume)
+	speed, _ := th.speedAt(config.Now())
+	th.apply(speed)
+	return th
+}
+
+// speedAt 合并任务限速、速度计划、允许时段、匀速目标和拟人化，返回 t 时刻的限速，暂停时同时返回原因
+func (th *throttle) speedAt(t time.Time) (int, string) {
+	if !config.WindowOpen(th.windows, t) {
+		return config.SpeedPaused, "不在允许的下载时段内"
+	}
+	speed := config.SpeedProfileAt(th.profile, t)
+	if speed == config.SpeedPaused {
+		return speed, "速度计划暂停"
+	}
+	limits := []int{th.base, th.paceAt(t)}
+	if th.human != nil {
+		rate, idle := th.human.at(t)
+		if idle {
+			return config.SpeedPaused, "随机停顿"
+		}
+		limits = append(limits, rate)
+	}
+	// 多个限制同时生效时取最严格的一个
+	for _, limit := range limits {
+		if limit > 0 && (speed == config.SpeedUnlimited || speed > limit) {
+			speed = limit
+		}
+	}
+	return speed, ""
+}
+
+// paceAt 计算在今天剩余的可下载时间内均匀完成目标下载量所需的速度（KB/s）
+// 未启用匀速模式或目标已完成时返回 SpeedUnlimited，目标完成后由额度检查停止下载
+func (th *throttle) paceAt(t time.Time) int {
+	if th.target <= 0 {
+		return config.SpeedUnlimited
+	}
+	remaining := th.target - docker.DailyDownloadedBytes()
+	if remaining <= 0 {
+		return config.SpeedUnlimited
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	left := config.OpenDuration(th.windows, t, midnight)
+	if left < time.Minute {
+		left = time.Minute
+	}
+	speed := int(float64(remaining) / 1024 / left.Seconds())
+	if speed < 1 {
+		speed = 1
+	}
+	return speed
+}
+
+// apply 切换到新的限速，暂停时阻塞所有连接，恢复时唤醒它们
+func (th *throttle) apply(speed int) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.speed = speed
+
+	if speed == config.SpeedPaused {
+		select {
+		case <-th.resume:
+			th.resume = make(chan struct{})
+		default:
+		}
+		return
+	}
+
+	if speed == config.SpeedUnlimited {
+		th.limiter.SetLimit(rate.Inf)
+	} else {
+		// 令牌桶：每秒产生 speed * 1024 个令牌，桶容量为 2 倍的每秒速率
+		th.limiter.SetBurst(speed * 1024 * 2)
+		th.limiter.SetLimit(rate.Limit(speed * 1024))
+	}
+
+	select {
+	case <-th.resume:
+	default:
+		close(th.resume)
+	}
+}
+
+// current 返回当前生效的限速
+func (th *throttle) current() int {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return th.speed
+}
+
+// maxRead 返回单次读取的上限，使读取量与令牌桶容量相当
+func (th *throttle) maxRead(n int) int {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	if th.limiter.Limit() != rate.Inf && n > th.limiter.Burst() {
+		return th.limiter.Burst()
+	}
+	return n
+}
+
+// waitResume 在暂停期间阻塞，直到恢复下载或 ctx 结束
+func (th *throttle) waitResume(ctx context.Context) error {
+	th.mu.RLock()
+	resume := th.resume
+	th.mu.RUnlock()
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait 等待消耗 n 个字节所需的令牌，暂停期间一直阻塞直到恢复或 ctx 结束
+func (th *throttle) wait(ctx context.Context, n int) error {
+	for n > 0 {
+		if err := th.waitResume(ctx); err != nil {
+			return err
+		}
+		chunk, err := th.waitChunk(ctx, n)
+		if err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// waitChunk 在读锁保护下等待不超过令牌桶容量的令牌，返回本次消耗的字节数
+func (th *throttle) waitChunk(ctx context.Context, n int) (int, error) {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	if th.limiter.Limit() != rate.Inf && n > th.limiter.Burst() {
+		n = th.limiter.Burst()
+	}
+	return n, th.limiter.WaitN(ctx, n)
+}
+
+// follow 跟随速度计划、允许时段、匀速目标和拟人化调整限速，暂停和恢复时更新任务状态，直到 ctx 结束
+func (th *throttle) follow(ctx context.Context, taskID string) {
+	if th == nil || (th.profile == nil && th.windows == nil && th.target <= 0 && th.human == nil) {
+		return
+	}
+	if speed, reason := th.speedAt(config.Now()); speed == config.SpeedPaused {
+		docker.SetTaskStatus(taskID, "已暂停")
+		docker.UpdateMessage("下载已暂停：%s", reason)
+	}
+
+	for {
+		// 速度计划按整点切换，允许时段精确到分钟，匀速模式每分钟重新计算速度，拟人化更频繁地变化
+		now := config.Now()
+		minute := now.Truncate(time.Minute).Add(time.Minute)
+		next := time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
+		// 夏令时开始时下一个整点可能不存在，换算出的时间早于当前，改为逐分钟检查
+		if th.windows != nil || th.target > 0 || !next.After(now) {
+			next = minute
+		}
+		if th.human != nil && now.Add(humanizeStep).Before(next) {
+			next = now.Add(humanizeStep)
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if th.human != nil {
+			th.human.step(next)
+		}
+		speed, reason := th.speedAt(next)
+		previous := th.current()
+		if speed == previous {
+			continue
+		}
+		th.apply(speed)
+		switch {
+		case speed == config.SpeedPaused:
+			docker.SetTaskStatus(taskID, "已暂停")
+			docker.UpdateMessage("下载已暂停：%s", reason)
+		case previous == config.SpeedPaused:
+			docker.SetTaskStatus(taskID, "下载中")
+			docker.UpdateMessage("下载已恢复，%s", describeSpeed(speed))
+		case th.target <= 0 && th.human == nil:
+			// 匀速模式和拟人化的速度变化频繁，不逐条提示
+			docker.UpdateMessage("速度计划：%s", describeSpeed(speed))
+		}
+	}
+}
+
+// describeSpeed 返回限速的文字描述
+func describeSpeed(speed int) string {
+	switch speed {
+	case config.SpeedUnlimited:
+		return "不限速"
+	case config.SpeedPaused:
+		return "暂停下载"
+	default:
+		return fmt.Sprintf("限速 %d KB/s", speed)
+	}
+}
+
+// rateLimitedReader 实现了限速的io.Reader
+type rateLimitedReader struct {
+	reader   io.Reader
+	throttle *throttle
+	ctx      context.Context
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if err := r.throttle.waitResume(r.ctx); err != nil {
+		return 0, err
+	}
+	// 单次读取不超过令牌桶容量，使速度更平滑
+	p = p[:r.throttle.maxRead(len(p))]
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		// 等待令牌
+		if err := r.throttle.wait(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,118 @@
+package humanize
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Source 是拟人化使用的随机数来源，可并发使用
+// 种子相同时产生相同的随机序列，便于测试和复现问题
+type Source struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// New 创建一个随机数来源，seed 为 0 时使用当前时间作为种子
+func New(seed int64) *Source {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Source{rng: rand.New(rand.NewPCG(uint64(seed), uint64(seed)>>32))}
+}
+
+// Between 返回 [min, max] 之间的随机整数，max 不大于 min 时返回 min
+func (s *Source) Between(min, max int64) int64 {
+	if max <= min {
+		return min
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return min + s.rng.Int64N(max-min+1)
+}
+
+// Duration 返回 [0, max] 之间的随机时长
+func (s *Source) Duration(max time.Duration) time.Duration {
+	return time.Duration(s.Between(0, int64(max)))
+}
+
+// Wander 从 cur 出发随机游走一步，步长不超过范围的五分之一，结果限制在 [min, max] 内
+func (s *Source) Wander(cur, min, max int) int {
+	if max <= min {
+		return min
+	}
+	step := (max - min) / 5
+	if step < 1 {
+		step = 1
+	}
+	next := cur + int(s.Between(int64(-step), int64(step)))
+	if next < min {
+		next = min
+	}
+	if next > max {
+		next = max
+	}
+	return next
+}
+
+// 随机数的用途，每个任务的每种用途使用独立的随机序列
+const (
+	PurposeStart = "start" // 开始时间的随机推迟
+	PurposeRun   = "run"   // 每次的随机下载量
+	PurposeRate  = "rate"  // 下载速度的随机变化
+	PurposeIdle  = "idle"  // 随机停顿的间隔和时长
+)
+
+// streamKey 标识一个随机序列
+type streamKey struct {
+	seed    int64
+	task    string
+	purpose string
+}
+
+var (
+	streams     = make(map[streamKey]*Source)
+	streamsLock sync.Mutex
+
+	// processSeed 是种子为 0 时使用的种子，每次启动时随机生成
+	processSeed = time.Now().UnixNano()
+)
+
+// Stream 返回按种子、任务和用途区分的随机数来源，同一组合多次调用返回同一个来源
+// 每个序列只取决于种子、任务、用途和已经取值的次数，不受其他任务或 goroutine 取值先后的影响
+func Stream(seed int64, task, purpose string) *Source {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+	key := streamKey{seed: seed, task: task, purpose: purpose}
+	if src, ok := streams[key]; ok {
+		return src
+	}
+	src := New(deriveSeed(seed, task, purpose))
+	streams[key] = src
+	return src
+}
+
+// Reset 丢弃所有随机序列，之后每个序列都从头开始
+// 修改种子时调用，使新的种子从第一次取值开始复现
+func Reset() {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+	clear(streams)
+}
+
+// deriveSeed 由种子、任务和用途计算出独立序列的种子，结果不为 0
+func deriveSeed(seed int64, task, purpose string) int64 {
+	if seed == 0 {
+		seed = processSeed
+	}
+	h := fnv.New64a()
+	h.Write([]byte(task))
+	h.Write([]byte{0})
+	h.Write([]byte(purpose))
+	derived := int64(h.Sum64() ^ uint64(seed)*0x9E3779B97F4A7C15)
+	if derived == 0 {
+		derived = 1
+	}
+	return derived
+}
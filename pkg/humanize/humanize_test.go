@@ -0,0 +1,91 @@
+package humanize
+
+import (
+	"testing"
+	"time"
+)
+
+func draw(src *Source, n int) []int64 {
+	out := make([]int64, n)
+	for i := range out {
+		out[i] = src.Between(0, 1_000_000)
+	}
+	return out
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewReproducible(t *testing.T) {
+	if !equal(draw(New(42), 20), draw(New(42), 20)) {
+		t.Error("相同的种子应该产生相同的序列")
+	}
+	if equal(draw(New(42), 20), draw(New(43), 20)) {
+		t.Error("不同的种子应该产生不同的序列")
+	}
+}
+
+func TestStreamIndependent(t *testing.T) {
+	Reset()
+	const seed = 7
+	want := draw(New(deriveSeed(seed, "task_a", PurposeRate)), 10)
+
+	// 其他任务和其他用途的取值穿插其中，不影响 task_a 的序列
+	a := Stream(seed, "task_a", PurposeRate)
+	var got []int64
+	for i := 0; i < 10; i++ {
+		Stream(seed, "task_b", PurposeRate).Between(0, 100)
+		Stream(seed, "task_a", PurposeIdle).Between(0, 100)
+		got = append(got, a.Between(0, 1_000_000))
+	}
+	if !equal(got, want) {
+		t.Errorf("得到 %v，期望 %v", got, want)
+	}
+
+	if Stream(seed, "task_a", PurposeRate) != a {
+		t.Error("同一组合应该返回同一个来源")
+	}
+	if deriveSeed(seed, "task_a", PurposeRate) == deriveSeed(seed, "task_b", PurposeRate) ||
+		deriveSeed(seed, "task_a", PurposeRate) == deriveSeed(seed, "task_a", PurposeIdle) {
+		t.Error("不同任务或用途应该使用不同的种子")
+	}
+}
+
+func TestStreamReset(t *testing.T) {
+	Reset()
+	first := draw(Stream(11, "main", PurposeStart), 5)
+	if next := draw(Stream(11, "main", PurposeStart), 5); equal(first, next) {
+		t.Error("同一序列应该继续取值，而不是从头开始")
+	}
+	Reset()
+	if again := draw(Stream(11, "main", PurposeStart), 5); !equal(first, again) {
+		t.Errorf("Reset 后应该从头开始: %v != %v", again, first)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	src := New(1)
+	for i := 0; i < 1000; i++ {
+		if v := src.Between(5, 10); v < 5 || v > 10 {
+			t.Fatalf("Between(5, 10) = %d", v)
+		}
+		if d := src.Duration(time.Second); d < 0 || d > time.Second {
+			t.Fatalf("Duration(1s) = %v", d)
+		}
+		if v := src.Wander(50, 10, 100); v < 10 || v > 100 {
+			t.Fatalf("Wander = %d", v)
+		}
+	}
+	if v := src.Between(10, 5); v != 10 {
+		t.Errorf("上限小于下限时应该返回下限，得到 %d", v)
+	}
+}
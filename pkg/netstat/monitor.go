@@ -0,0 +1,78 @@
+package netstat
+
+import (
+	"log"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+)
+
+// sampleInterval 是网卡计数器的采样间隔
+const sampleInterval = 30 * time.Second
+
+// StartMonitor 定期采样网卡计数器，将各网卡的收发增量计入统计
+func StartMonitor() {
+	ticker := time.NewTicker(sampleInterval)
+
+	go func() {
+		// 上一次采样的计数器，没有基准值的网卡只记录不计入
+		last := make(map[string]Counters)
+		for range ticker.C {
+			cfg := config.GetConfig()
+			ifaces := Watched(cfg)
+			if len(ifaces) == 0 {
+				clear(last)
+				docker.RecordInterfaceSample(nil)
+				continue
+			}
+
+			path := ConfiguredPath(cfg)
+			all, err := ReadAll(path)
+			if err != nil {
+				log.Printf("网卡监控：读取 %s 失败: %v", path, err)
+				continue
+			}
+
+			current := make(map[string]Counters, len(ifaces))
+			deltas := make(map[string]docker.TrafficDelta, len(ifaces))
+			for _, name := range ifaces {
+				cur, ok := all[name]
+				if !ok {
+					continue
+				}
+				current[name] = cur
+				if prev, ok := last[name]; ok {
+					deltas[name] = docker.TrafficDelta{
+						RX: int64(Delta(prev.RX, cur.RX)),
+						TX: int64(Delta(prev.TX, cur.TX)),
+					}
+				}
+			}
+			docker.RecordInterfaceSample(deltas)
+			last = current
+		}
+	}()
+}
+
+// ConfiguredPath 返回配置中的计数器文件路径，未设置时使用 DefaultPath
+func ConfiguredPath(cfg config.Config) string {
+	if cfg.NetDevPath == "" {
+		return DefaultPath
+	}
+	return cfg.NetDevPath
+}
+
+// Watched 返回需要采样的网卡：所有监控的网卡以及比例模式使用的网卡
+func Watched(cfg config.Config) []string {
+	ifaces := append([]string(nil), cfg.MonitorInterfaces...)
+	if cfg.RatioEnabled && cfg.RatioInterface != "" {
+		for _, name := range ifaces {
+			if name == cfg.RatioInterface {
+				return ifaces
+			}
+		}
+		ifaces = append(ifaces, cfg.RatioInterface)
+	}
+	return ifaces
+}
@@ -0,0 +1,70 @@
+package netstat
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultPath 是 Linux 下网卡流量计数器的默认位置
+const DefaultPath = "/proc/net/dev"
+
+// Counters 是网卡自启动以来的累计收发字节数
+type Counters struct {
+	RX uint64 `json:"rx"` // 接收（下载）
+	TX uint64 `json:"tx"` // 发送（上传）
+}
+
+// ReadAll 读取 /proc/net/dev 格式的文件，返回所有网卡的计数器
+func ReadAll(path string) (map[string]Counters, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string]Counters)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 格式: "  eth0: 接收字节 包 错误 丢弃 fifo frame compressed multicast 发送字节 ..."
+		// 前两行是表头，不含冒号以外的数据
+		name, data, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(data)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err1 := strconv.ParseUint(fields[0], 10, 64)
+		tx, err2 := strconv.ParseUint(fields[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		result[strings.TrimSpace(name)] = Counters{RX: rx, TX: tx}
+	}
+	return result, scanner.Err()
+}
+
+// Read 读取指定网卡的计数器
+func Read(path, iface string) (Counters, error) {
+	all, err := ReadAll(path)
+	if err != nil {
+		return Counters{}, err
+	}
+	c, ok := all[iface]
+	if !ok {
+		return Counters{}, fmt.Errorf("找不到网卡 %s", iface)
+	}
+	return c, nil
+}
+
+// Delta 计算两次采样之间的增量，计数器因重启或溢出变小时以当前值作为增量
+func Delta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
@@ -0,0 +1,59 @@
+package netstat
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadAll(t *testing.T) {
+	all, err := ReadAll(filepath.Join("testdata", "net_dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Counters{
+		"lo":    {RX: 123456, TX: 123456},
+		"eth0":  {RX: 9876543210, TX: 1234567890},
+		"wlan0": {RX: 555, TX: 777},
+	}
+	if len(all) != len(want) {
+		t.Fatalf("读到 %d 个网卡，期望 %d 个: %v", len(all), len(want), all)
+	}
+	for name, c := range want {
+		if all[name] != c {
+			t.Errorf("%s: 得到 %+v，期望 %+v", name, all[name], c)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	path := filepath.Join("testdata", "net_dev")
+	c, err := Read(path, "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RX != 9876543210 || c.TX != 1234567890 {
+		t.Errorf("得到 %+v", c)
+	}
+	if _, err := Read(path, "eth1"); err == nil {
+		t.Error("不存在的网卡应该返回错误")
+	}
+	if _, err := ReadAll(filepath.Join("testdata", "missing")); err == nil {
+		t.Error("文件不存在时应该返回错误")
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		prev, cur, want uint64
+	}{
+		{100, 250, 150},
+		{100, 100, 0},
+		// 计数器重置后以当前值作为增量
+		{1000, 30, 30},
+	}
+	for _, tt := range tests {
+		if got := Delta(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("Delta(%d, %d) = %d，期望 %d", tt.prev, tt.cur, got, tt.want)
+		}
+	}
+}
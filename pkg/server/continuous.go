@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/downloader"
+)
+
+// continuousFailureDelay 是持续下载失败后再次开始前的最短等待时间，避免地址不可用时反复请求
+const continuousFailureDelay = 30 * time.Second
+
+var (
+	// cycling 记录正在循环执行的持续下载任务，冷却期间也算在内
+	cycling     = make(map[string]bool)
+	cyclingLock sync.Mutex
+)
+
+// runContinuous 循环执行持续下载的任务，每次下载结束并等待冷却时间后立即开始下一次
+// 手动停止、任务被禁用或改为其他计划、不在允许时段或额度用完时退出，之后由调度器在条件满足时重新开始
+func runContinuous(task config.Task) {
+	cyclingLock.Lock()
+	if cycling[task.ID] {
+		cyclingLock.Unlock()
+		return
+	}
+	cycling[task.ID] = true
+	cyclingLock.Unlock()
+	defer func() {
+		cyclingLock.Lock()
+		delete(cycling, task.ID)
+		cyclingLock.Unlock()
+	}()
+
+	delay := startJitter(config.GetConfig(), task.ID)
+	for {
+		if !waitBeforeStart(task, delay) {
+			return
+		}
+
+		// 任务可能在下载或等待期间被修改、禁用或删除
+		latest, ok := config.GetTask(task.ID)
+		if !ok || !latest.Enabled || latest.PlanType != "continuous" {
+			return
+		}
+		task = latest
+
+		docker.CheckAndResetStats()
+		cfg := config.GetConfig()
+		if reason, blocked := startBlocked(cfg); blocked {
+			docker.SetTaskStatus(task.ID, "已跳过")
+			docker.UpdateMessage("持续下载：%s，任务 %s 暂停循环", reason, task.Name)
+			return
+		}
+
+		// 以最低优先级排队，其他下载可以在两次持续下载之间插入
+		job, added := jobs.enqueue(task, "continuous", priorityContinuous, "持续下载")
+		if !added {
+			return // 已有手动或定时的下载在排队，交给那次下载
+		}
+		err := <-job.done
+		if errors.Is(err, downloader.ErrStopped) || errors.Is(err, errJobSkipped) || errors.Is(err, errJobCanceled) {
+			return
+		}
+
+		delay = time.Duration(task.CooldownSeconds) * time.Second
+		if err != nil && delay < continuousFailureDelay {
+			delay = continuousFailureDelay
+		}
+		delay += startJitter(cfg, task.ID)
+	}
+}
+
+// cycleActive 判断任务是否正在循环执行
+func cycleActive(taskID string) bool {
+	cyclingLock.Lock()
+	defer cyclingLock.Unlock()
+	return cycling[taskID]
+}
@@ -5,14 +5,18 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"os"
 	"log"
 	"io/fs"
 
 	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/cron"
 	"docker-cycler/pkg/docker"
 	dockerPkg "docker-cycler/pkg/docker"
-	"docker-cycler/pkg/downloader"
+	"docker-cycler/pkg/humanize"
+	"docker-cycler/pkg/urlpool"
 )
 
 var embeddedFS embed.FS
@@ -39,7 +43,19 @@ func RegisterHandlers() {
 	http.HandleFunc("/api/stop", stopHandler)
 	http.HandleFunc("/api/toggle_task", toggleTaskHandler)
 	http.HandleFunc("/api/toggle_limit", toggleLimitHandler)
+	http.HandleFunc("/api/toggle_monthly_limit", toggleMonthlyLimitHandler)
 	http.HandleFunc("/api/clean", cleanHandler)
+	http.HandleFunc("/api/mirrors", mirrorsHandler)
+	http.HandleFunc("/api/history", historyHandler)
+	http.HandleFunc("/api/cron/preview", cronPreviewHandler)
+	http.HandleFunc("/api/tasks", tasksHandler)
+	http.HandleFunc("/api/tasks/run", taskRunHandler)
+	http.HandleFunc("/api/tasks/stop", taskStopHandler)
+	http.HandleFunc("/api/interfaces", interfacesHandler)
+	http.HandleFunc("/api/queue", queueHandler)
+
+	// Prometheus 指标
+	http.HandleFunc("/metrics", metricsHandler)
 }
 
 // --- 页面处理器 ---
@@ -61,7 +77,7 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func progressHandler(w http.ResponseWriter, r *http.Request) {
-	respondWithJSON(w, http.StatusOK, docker.GetProgress())
+	respondWithJSON(w, http.StatusOK, docker.GetProgress(config.MainTaskID))
 }
 
 func setHandler(w http.ResponseWriter, r *http.Request) {
@@ -70,25 +86,185 @@ func setHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var urls []config.URLEntry
+	if raw := r.FormValue("urls"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &urls); err != nil {
+			respondWithError(w, http.StatusBadRequest, "URL列表格式错误: "+err.Error())
+			return
+		}
+	}
+	for i := range urls {
+		urls[i].URL = strings.TrimSpace(urls[i].URL)
+	}
+	strategy := r.FormValue("url_strategy")
+	if strategy == "" {
+		strategy = "round_robin"
+	}
+	if !urlpool.ValidStrategy(strategy) {
+		respondWithError(w, http.StatusBadRequest, "不支持的URL选择策略: "+strategy)
+		return
+	}
+
+	planType := r.FormValue("plan_type")
+	cronExpr := strings.TrimSpace(r.FormValue("cron_expr"))
+	if planType == "cron" {
+		if _, err := cron.Parse(cronExpr); err != nil {
+			respondWithError(w, http.StatusBadRequest, "cron 表达式无效: "+err.Error())
+			return
+		}
+	}
+
+	timezone := strings.TrimSpace(r.FormValue("timezone"))
+	if _, err := config.LoadLocation(timezone); err != nil {
+		respondWithError(w, http.StatusBadRequest, "无效的时区: "+timezone)
+		return
+	}
+
+	catchUp := r.FormValue("catch_up")
+	if catchUp == "" {
+		catchUp = "skip"
+	}
+	if !config.ValidCatchUp(catchUp) {
+		respondWithError(w, http.StatusBadRequest, "不支持的补跑策略: "+catchUp)
+		return
+	}
+
+	var speedProfile []int
+	if raw := r.FormValue("speed_profile"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &speedProfile); err != nil {
+			respondWithError(w, http.StatusBadRequest, "速度计划格式错误: "+err.Error())
+			return
+		}
+	}
+	if err := config.ValidateSpeedProfile(speedProfile); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limitSource := r.FormValue("limit_source")
+	switch limitSource {
+	case "":
+		limitSource = "self"
+	case "self":
+	case "interface_rx", "interface_total":
+		// 没有监控的网卡时网卡流量始终为 0，限制永远不会生效
+		if len(splitList(r.FormValue("monitor_interfaces"))) == 0 {
+			respondWithError(w, http.StatusBadRequest, "按网卡流量限制时需要设置监控的网卡")
+			return
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "不支持的统计口径: "+limitSource)
+		return
+	}
+
+	var windows []config.TimeWindow
+	if raw := r.FormValue("active_windows"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &windows); err != nil {
+			respondWithError(w, http.StatusBadRequest, "允许时段格式错误: "+err.Error())
+			return
+		}
+	}
+	if err := config.ValidateWindows(windows); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	human := parseHumanize(r, config.GetConfig().Humanize)
+	if err := human.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// 修改种子后随机序列从头开始，相同的种子总是得到相同的序列
+	if human.Seed != config.GetConfig().Humanize.Seed {
+		humanize.Reset()
+	}
+
 	config.UpdateConfig(func(c *config.Config) {
-		c.URL = r.FormValue("url")
-		c.PlanType = r.FormValue("plan_type")
+		c.URLs = urls
+		c.URLStrategy = strategy
+		c.PlanType = planType
+		if cronExpr != "" {
+			c.CronExpr = cronExpr
+		}
 		c.Dir = r.FormValue("dir")
+		c.SinkMode = r.FormValue("sink_mode") == "true"
+		c.SpeedProfileEnabled = r.FormValue("speed_profile_enabled") == "true"
+		if speedProfile != nil {
+			c.SpeedProfile = speedProfile
+		}
+		c.ActiveWindowsEnabled = r.FormValue("active_windows_enabled") == "true"
+		if windows != nil {
+			c.ActiveWindows = windows
+		}
 		if val, err := strconv.Atoi(r.FormValue("interval_minutes")); err == nil {
 			c.IntervalMinutes = val
 		}
+		if val, err := strconv.Atoi(r.FormValue("cooldown_seconds")); err == nil && val >= 0 {
+			c.CooldownSeconds = val
+		}
 		if val, err := strconv.Atoi(r.FormValue("hour")); err == nil {
 			c.Hour = val
 		}
 		if val, err := strconv.Atoi(r.FormValue("minute")); err == nil {
 			c.Minute = val
 		}
+		if val, err := strconv.Atoi(r.FormValue("jitter_minutes")); err == nil && val >= 0 && val <= config.MaxJitterMinutes {
+			c.JitterMinutes = val
+		}
+		c.CatchUp = catchUp
+		c.Timezone = timezone
 		if val, err := strconv.Atoi(r.FormValue("speed")); err == nil {
 			c.SpeedKB = val
 		}
+		if val, err := strconv.Atoi(r.FormValue("connections")); err == nil {
+			c.Connections = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("run_limit_mb")); err == nil {
+			c.RunLimitMB = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("run_limit_minutes")); err == nil {
+			c.RunLimitMinutes = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("retry_count")); err == nil {
+			c.RetryCount = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("retry_delay_seconds")); err == nil {
+			c.RetryDelaySeconds = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("probe_interval_minutes")); err == nil {
+			c.ProbeIntervalMinutes = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("probe_size_kb")); err == nil {
+			c.ProbeSizeKB = val
+		}
 		if val, err := strconv.Atoi(r.FormValue("limit_mb")); err == nil {
 			c.LimitMB = val
 		}
+		if val, err := strconv.Atoi(r.FormValue("monthly_limit_mb")); err == nil {
+			c.MonthlyLimitMB = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("billing_day")); err == nil && val >= 1 && val <= 31 {
+			c.BillingDay = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("history_months")); err == nil && val > 0 {
+			c.HistoryMonths = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("max_concurrent")); err == nil && val > 0 {
+			c.MaxConcurrent = val
+		}
+		c.PacingEnabled = r.FormValue("pacing_enabled") == "true"
+		c.Humanize = human
+		c.NetDevPath = strings.TrimSpace(r.FormValue("net_dev_path"))
+		c.MonitorInterfaces = splitList(r.FormValue("monitor_interfaces"))
+		c.LimitSource = limitSource
+		c.RatioEnabled = r.FormValue("ratio_enabled") == "true"
+		c.RatioInterface = strings.TrimSpace(r.FormValue("ratio_interface"))
+		if val, err := strconv.ParseFloat(r.FormValue("ratio_target"), 64); err == nil && val > 0 {
+			c.RatioTarget = val
+		}
+		if val, err := strconv.Atoi(r.FormValue("pacing_target_mb")); err == nil && val > 0 {
+			c.PacingTargetMB = val
+		}
 	})
 
 	if err := config.SaveConfig(); err != nil {
@@ -100,45 +276,44 @@ func setHandler(w http.ResponseWriter, r *http.Request) {
 	cfg := config.GetConfig()
 	os.MkdirAll(cfg.Dir, 0755)
 
+	docker.CheckAndResetStats() // 计费日或时区可能已修改，立即调整计费周期
+	refreshNextDue()
+	jobs.signal() // 并发上限可能已提高
 	docker.UpdateMessage("配置已保存")
 	respondWithJSON(w, http.StatusOK, docker.GetAppStatus())
 }
 
+// parseHumanize 从表单中读取拟人化参数，未提交的项保持原值
+func parseHumanize(r *http.Request, h config.Humanize) config.Humanize {
+	h.Enabled = r.FormValue("humanize_enabled") == "true"
+	if val, err := strconv.ParseInt(r.FormValue("humanize_seed"), 10, 64); err == nil {
+		h.Seed = val
+	}
+	for name, field := range map[string]*int{
+		"humanize_start_jitter_seconds": &h.StartJitterSeconds,
+		"humanize_run_min_mb":           &h.RunMinMB,
+		"humanize_run_max_mb":           &h.RunMaxMB,
+		"humanize_rate_min_kb":          &h.RateMinKB,
+		"humanize_rate_max_kb":          &h.RateMaxKB,
+		"humanize_idle_every_minutes":   &h.IdleEveryMinutes,
+		"humanize_idle_min_seconds":     &h.IdleMinSeconds,
+		"humanize_idle_max_seconds":     &h.IdleMaxSeconds,
+	} {
+		if val, err := strconv.Atoi(r.FormValue(name)); err == nil {
+			*field = val
+		}
+	}
+	return h
+}
+
 func downloadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		respondWithError(w, http.StatusMethodNotAllowed, "只允许POST方法")
 		return
 	}
 
-	go func() {
-		cfg := config.GetConfig()
-		if cfg.URL == "" {
-			docker.UpdateMessage("下载失败: 未设置下载地址")
-			return
-		}
-
-		// 检查下载限制 - 使用配置文件中的设置
-		status := docker.GetAppStatus()
-		if cfg.DailyLimitEnabled && status.Stats.DailyDownloadedMB >= cfg.LimitMB {
-			docker.UpdateMessage("今日下载量已达上限")
-			return
-		}
-
-		docker.SetTaskStatus("下载中")
-		docker.NewDownloadContext() // 为这次手动下载创建一个新的上下文
-
-		file, size, err := downloader.DownloadFileWithProgress(docker.GetDownloadContext(), cfg.URL, cfg.SpeedKB, cfg.Dir)
-		if err != nil {
-			docker.SetTaskStatus("失败")
-			docker.UpdateMessage("下载失败: %v", err)
-		} else {
-			docker.SetTaskStatus("空闲")
-			docker.UpdateMessage("下载成功: %s", file)
-			docker.UpdateLastDownloadInfo(file, true)
-			docker.AddDownloadStats(size)
-		}
-	}()
-
+	// 开始时再检查允许时段和下载限制，下载过程中额度用完也会自动停止
+	enqueueManual(config.GetConfig().MainTask())
 	respondWithJSON(w, http.StatusAccepted, docker.GetAppStatus())
 }
 
@@ -147,7 +322,7 @@ func stopHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusMethodNotAllowed, "只允许POST方法")
 		return
 	}
-	docker.NewDownloadContext() // 取消当前下载上下文
+	stopTask("") // 取消所有排队、等待和正在进行的下载
 	docker.UpdateMessage("已发送停止信号")
 	respondWithJSON(w, http.StatusOK, docker.GetAppStatus())
 }
@@ -168,6 +343,7 @@ func toggleTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if enabled {
 		msg = "启用"
 	}
+	refreshNextDue()
 	docker.UpdateMessage("定时任务已%s", msg)
 	respondWithJSON(w, http.StatusOK, docker.GetAppStatus())
 }
@@ -192,6 +368,26 @@ func toggleLimitHandler(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, docker.GetAppStatus())
 }
 
+func toggleMonthlyLimitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许POST方法")
+		return
+	}
+
+	enabled, err := config.ToggleMonthlyLimitEnabled()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "切换限制状态失败: "+err.Error())
+		return
+	}
+
+	msg := "关闭"
+	if enabled {
+		msg = "启用"
+	}
+	docker.UpdateMessage("每月下载量限制已%s", msg)
+	respondWithJSON(w, http.StatusOK, docker.GetAppStatus())
+}
+
 func cleanHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		respondWithError(w, http.StatusMethodNotAllowed, "只允许POST方法")
@@ -204,6 +400,112 @@ func cleanHandler(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusAccepted, docker.GetAppStatus())
 }
 
+// mirrorsHandler GET 返回镜像测速结果，POST 立即触发一次测速
+func mirrorsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondWithJSON(w, http.StatusOK, urlpool.GetMirrorStatus())
+	case http.MethodPost:
+		cfg := config.GetConfig()
+		if reason, blocked := urlpool.ProbeBlocked(cfg); blocked {
+			respondWithError(w, http.StatusConflict, reason+"，无法测速")
+			return
+		}
+		go urlpool.ProbeAll(cfg)
+		docker.UpdateMessage("镜像测速已启动")
+		respondWithJSON(w, http.StatusAccepted, urlpool.GetMirrorStatus())
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET或POST方法")
+	}
+}
+
+// historyHandler 返回历史下载统计
+// 参数: from/to 为 "2006-01-02" 格式的日期（默认最近30天），granularity 为 "day"（默认）或 "hour"
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET方法")
+		return
+	}
+
+	now := config.Now()
+	to := now
+	from := now.AddDate(0, 0, -29)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "to 日期格式错误，应为 2006-01-02")
+			return
+		}
+		to = t
+		from = t.AddDate(0, 0, -29)
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "from 日期格式错误，应为 2006-01-02")
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		respondWithError(w, http.StatusBadRequest, "from 不能晚于 to")
+		return
+	}
+
+	granularity := r.URL.Query().Get("granularity")
+	switch granularity {
+	case "", "day":
+		granularity = "day"
+	case "hour":
+	default:
+		respondWithError(w, http.StatusBadRequest, "granularity 只能为 day 或 hour")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from":        from.Format("2006-01-02"),
+		"to":          to.Format("2006-01-02"),
+		"granularity": granularity,
+		"entries":     docker.GetHistory(from, to, granularity == "hour"),
+	})
+}
+
+// cronPreviewHandler 校验 cron 表达式并返回接下来的触发时间
+// 参数: expr 为 cron 表达式（默认使用当前配置），n 为返回的次数（默认5，最多50）
+func cronPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET方法")
+		return
+	}
+
+	expr := r.URL.Query().Get("expr")
+	if expr == "" {
+		expr = config.GetConfig().CronExpr
+	}
+	n := 5
+	if val, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && val > 0 {
+		n = val
+	}
+	if n > 50 {
+		n = 50
+	}
+
+	sched, err := cron.Parse(expr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "cron 表达式无效: "+err.Error())
+		return
+	}
+
+	times := []string{}
+	for _, t := range sched.NextN(config.Now(), n) {
+		times = append(times, t.Format("2006-01-02 15:04 Mon"))
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"expr": expr,
+		"next": times,
+	})
+}
+
 // --- 辅助函数 ---
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/netstat"
+)
+
+// interfaceView 是网卡列表中的一项
+type interfaceView struct {
+	Name     string                  `json:"name"`
+	Counters netstat.Counters        `json:"counters"` // 计数器文件中的当前值
+	Traffic  docker.InterfaceTraffic `json:"traffic"`  // 开始监控以来的统计
+	Watched  bool                    `json:"watched"`  // 是否正在采样
+}
+
+// interfacesHandler 返回本机所有网卡的计数器和已统计的流量，供选择监控的网卡
+func interfacesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET方法")
+		return
+	}
+	cfg := config.GetConfig()
+	counters, err := netstat.ReadAll(netstat.ConfiguredPath(cfg))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "读取网卡信息失败: "+err.Error())
+		return
+	}
+
+	watched := make(map[string]bool)
+	for _, name := range netstat.Watched(cfg) {
+		watched[name] = true
+	}
+	traffic := docker.GetInterfaceTraffic()
+
+	views := make([]interfaceView, 0, len(counters))
+	for name, c := range counters {
+		views = append(views, interfaceView{
+			Name:     name,
+			Counters: c,
+			Traffic:  traffic[name],
+			Watched:  watched[name],
+		})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	respondWithJSON(w, http.StatusOK, views)
+}
+
+// splitList 将以逗号或空白分隔的列表拆分为切片，忽略空项
+func splitList(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '，' || unicode.IsSpace(r)
+	})
+	if fields == nil {
+		return []string{}
+	}
+	return fields
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+)
+
+// taskStatusLabels 是 cycler_task_status 指标输出的全部状态及其标签值
+// 标签使用固定的英文值，不随界面文字变化
+var taskStatusLabels = []struct {
+	status string
+	label  string
+}{
+	{"空闲", "idle"},
+	{"排队中", "queued"},
+	{"下载中", "downloading"},
+	{"已暂停", "paused"},
+	{"已跳过", "skipped"},
+	{"失败", "failed"},
+	{"已停止", "stopped"},
+}
+
+// metricsHandler 以 Prometheus 文本格式输出运行指标
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET方法")
+		return
+	}
+
+	status := docker.GetAppStatus()
+	cfg := status.Config
+	stats := status.Stats
+
+	var b strings.Builder
+
+	writeMetric(&b, "cycler_downloaded_bytes_total", "counter", "累计下载字节数", stats.TotalDownloadedBytes)
+	writeMetric(&b, "cycler_downloaded_bytes_today", "gauge", "今日下载字节数", stats.DailyDownloadedBytes)
+	writeMetric(&b, "cycler_downloaded_bytes_cycle", "gauge", "当前计费周期下载字节数", stats.MonthlyDownloadedBytes)
+	writeMetric(&b, "cycler_speed_limit_bytes", "gauge", "限速设置（字节/秒），0 表示不限速", int64(cfg.SpeedKB)*1024)
+	writeMetric(&b, "cycler_task_enabled", "gauge", "自动任务是否启用", boolValue(status.TaskEnabled))
+	running, pending := jobs.snapshot()
+	writeMetric(&b, "cycler_queue_running", "gauge", "正在执行的下载数", int64(len(running)))
+	writeMetric(&b, "cycler_queue_pending", "gauge", "队列中等待的下载数", int64(len(pending)))
+
+	fmt.Fprintf(&b, "# HELP cycler_runs_total 下载任务结束次数\n# TYPE cycler_runs_total counter\n")
+	fmt.Fprintf(&b, "cycler_runs_total{result=\"success\"} %d\n", stats.RunsSucceeded)
+	fmt.Fprintf(&b, "cycler_runs_total{result=\"failure\"} %d\n", stats.RunsFailed)
+
+	// 各任务可以同时下载，速度和状态按任务ID分别输出
+	tasks := cfg.AllTasks()
+	fmt.Fprintf(&b, "# HELP cycler_download_speed_bytes 任务当前的下载速度（字节/秒）\n# TYPE cycler_download_speed_bytes gauge\n")
+	for _, task := range tasks {
+		var speed int64
+		if docker.GetTaskStatus(task.ID) == "下载中" {
+			speed = int64(docker.GetProgress(task.ID).Speed) * 1024
+		}
+		fmt.Fprintf(&b, "cycler_download_speed_bytes{task=%q} %d\n", task.ID, speed)
+	}
+	fmt.Fprintf(&b, "# HELP cycler_task_status 任务当前的状态，对应状态为 1\n# TYPE cycler_task_status gauge\n")
+	for _, task := range tasks {
+		current := docker.GetTaskStatus(task.ID)
+		for _, s := range taskStatusLabels {
+			fmt.Fprintf(&b, "cycler_task_status{task=%q,status=%q} %d\n", task.ID, s.label, boolValue(current == s.status))
+		}
+	}
+
+	dailyUsed, monthlyUsed := docker.QuotaUsage()
+	fmt.Fprintf(&b, "# HELP cycler_quota_remaining_bytes 剩余下载额度（字节），仅输出已启用的限制\n# TYPE cycler_quota_remaining_bytes gauge\n")
+	if cfg.DailyLimitEnabled {
+		fmt.Fprintf(&b, "cycler_quota_remaining_bytes{period=\"daily\"} %d\n", nonNegative(int64(cfg.LimitMB)*1024*1024-dailyUsed))
+	}
+	if cfg.MonthlyLimitEnabled {
+		fmt.Fprintf(&b, "cycler_quota_remaining_bytes{period=\"monthly\"} %d\n", nonNegative(int64(cfg.MonthlyLimitMB)*1024*1024-monthlyUsed))
+	}
+
+	fmt.Fprintf(&b, "# HELP cycler_interface_bytes_total 监控网卡的累计收发字节数\n# TYPE cycler_interface_bytes_total counter\n")
+	names := make([]string, 0, len(stats.Interfaces))
+	for name := range stats.Interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		it := stats.Interfaces[name]
+		fmt.Fprintf(&b, "cycler_interface_bytes_total{interface=%q,direction=\"rx\"} %d\n", name, it.TotalRX)
+		fmt.Fprintf(&b, "cycler_interface_bytes_total{interface=%q,direction=\"tx\"} %d\n", name, it.TotalTX)
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", stats.LastDownload, config.GetConfig().Location()); err == nil {
+		writeMetric(&b, "cycler_last_success_timestamp_seconds", "gauge", "最近一次下载成功的 Unix 时间戳", t.Unix())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, b.String())
+}
+
+// writeMetric 输出一个不带标签的指标
+func writeMetric(b *strings.Builder, name, typ, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+}
+
+func boolValue(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func nonNegative(v int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/downloader"
+)
+
+// 下载来源的优先级，数值越大越先执行，相同优先级按加入队列的先后执行
+const (
+	priorityContinuous = 0
+	prioritySchedule   = 10
+	priorityRatio      = 20
+	priorityManual     = 30
+)
+
+var (
+	// errJobSkipped 表示任务开始时不在允许时段、额度已用完或已被删除，没有下载
+	errJobSkipped = errors.New("任务已跳过")
+	// errJobCanceled 表示任务在等待期间被移出队列
+	errJobCanceled = errors.New("任务已取消")
+)
+
+// Job 是下载队列中的一项
+type Job struct {
+	ID        string     `json:"id"`
+	TaskID    string     `json:"task_id"`
+	TaskName  string     `json:"task_name"`
+	Source    string     `json:"source"` // "manual", "schedule", "continuous" or "ratio"
+	Priority  int        `json:"priority"`
+	State     string     `json:"state"` // "等待中" or "执行中"
+	QueuedAt  time.Time  `json:"queued_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+
+	label  string
+	adjust []func(*downloader.Options)
+	done   chan error // 下载结束后写入结果，容量为 1
+}
+
+// jobQueue 按优先级调度所有下载，限制同时下载的任务数，同一任务同时只有一个下载
+type jobQueue struct {
+	mu      sync.Mutex
+	pending []*Job          // 按加入顺序排列
+	running map[string]*Job // 按任务ID索引
+	seq     int
+	wake    chan struct{}
+}
+
+var jobs = newJobQueue()
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{
+		running: make(map[string]*Job),
+		wake:    make(chan struct{}, 1),
+	}
+	go q.dispatch()
+	return q
+}
+
+// enqueue 将任务的一次下载加入队列，返回队列中的任务以及是否为新加入的
+// 手动下载只与等待中的同一任务合并，可以排在正在执行的下载之后；其他来源在任务等待或执行时都不再加入
+// 合并时采用优先级较高的请求的来源、说明和下载参数，例如手动下载不再受比例补齐的下载量限制
+func (q *jobQueue) enqueue(task config.Task, source string, priority int, label string, adjust ...func(*downloader.Options)) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.pending {
+		if job.TaskID == task.ID {
+			if priority > job.Priority {
+				job.Priority = priority
+				job.Source = source
+				job.label = label
+				job.adjust = adjust
+			}
+			return job, false
+		}
+	}
+	if running, ok := q.running[task.ID]; ok && source != "manual" {
+		return running, false
+	}
+
+	q.seq++
+	job := &Job{
+		ID:       fmt.Sprintf("job_%d", q.seq),
+		TaskID:   task.ID,
+		TaskName: task.Name,
+		Source:   source,
+		Priority: priority,
+		State:    "等待中",
+		QueuedAt: config.Now(),
+		label:    label,
+		adjust:   adjust,
+		done:     make(chan error, 1),
+	}
+	q.pending = append(q.pending, job)
+	if _, ok := q.running[task.ID]; !ok {
+		docker.SetTaskStatus(task.ID, "排队中")
+	}
+	q.signal()
+	return job, true
+}
+
+// signal 唤醒调度循环
+func (q *jobQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 在队列变化或下载结束时启动可以执行的下载
+func (q *jobQueue) dispatch() {
+	for range q.wake {
+		for job := q.next(); job != nil; job = q.next() {
+			go q.execute(job)
+		}
+	}
+}
+
+// next 取出下一个可以执行的任务，达到并发上限或没有可执行的任务时返回 nil
+func (q *jobQueue) next() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.running) >= max(config.GetConfig().MaxConcurrent, 1) {
+		return nil
+	}
+	best := -1
+	for i, job := range q.pending {
+		if _, busy := q.running[job.TaskID]; busy {
+			continue
+		}
+		if best < 0 || job.Priority > q.pending[best].Priority {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	job := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	now := config.Now()
+	job.State = "执行中"
+	job.StartedAt = &now
+	q.running[job.TaskID] = job
+	return job
+}
+
+// execute 执行一次下载，开始前重新检查任务和下载限制
+func (q *jobQueue) execute(job *Job) {
+	err := q.start(job)
+	q.mu.Lock()
+	delete(q.running, job.TaskID)
+	q.mu.Unlock()
+	job.done <- err
+	q.signal()
+}
+
+// start 使用最新的配置执行任务，任务已删除或当前不允许下载时跳过
+func (q *jobQueue) start(job *Job) error {
+	task, ok := config.GetTask(job.TaskID)
+	if !ok {
+		return errJobSkipped
+	}
+	docker.CheckAndResetStats()
+	cfg := config.GetConfig()
+	if reason, blocked := startBlocked(cfg); blocked {
+		docker.SetTaskStatus(task.ID, "已跳过")
+		docker.UpdateMessage("%s，任务 %s 跳过", reason, task.Name)
+		return errJobSkipped
+	}
+	return runDownload(cfg, task, job.label, job.adjust...)
+}
+
+// cancel 移除等待中的任务，返回是否找到
+func (q *jobQueue) cancel(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, job := range q.pending {
+		if job.ID == id {
+			q.removeLocked(i)
+			return true
+		}
+	}
+	return false
+}
+
+// cancelTask 移除指定任务所有等待中的下载，taskID 为空时移除全部
+func (q *jobQueue) cancelTask(taskID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.pending) - 1; i >= 0; i-- {
+		if taskID == "" || q.pending[i].TaskID == taskID {
+			q.removeLocked(i)
+		}
+	}
+}
+
+// removeLocked 移除第 i 个等待中的任务并通知等待结果的调用方，调用方需持有 mu
+// 被移除的任务标记为已停止，持续下载的任务不会被调度器立即重新加入
+func (q *jobQueue) removeLocked(i int) {
+	job := q.pending[i]
+	q.pending = append(q.pending[:i], q.pending[i+1:]...)
+	if _, ok := q.running[job.TaskID]; !ok {
+		docker.SetTaskStatus(job.TaskID, "已停止")
+	}
+	job.done <- errJobCanceled
+}
+
+// busy 判断任务是否在队列中等待或正在执行
+func (q *jobQueue) busy(taskID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.running[taskID]; ok {
+		return true
+	}
+	for _, job := range q.pending {
+		if job.TaskID == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot 返回正在执行和等待中的任务，等待中的按执行顺序排列
+func (q *jobQueue) snapshot() (running, pending []Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	running, pending = []Job{}, []Job{}
+	for _, job := range q.running {
+		running = append(running, *job)
+	}
+	for _, job := range q.pending {
+		pending = append(pending, *job)
+	}
+	sortJobs(running)
+	sortJobs(pending)
+	return running, pending
+}
+
+// sortJobs 按执行顺序排列：优先级高的在前，相同优先级先加入的在前
+func sortJobs(list []Job) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority {
+			return list[i].Priority > list[j].Priority
+		}
+		return list[i].QueuedAt.Before(list[j].QueuedAt)
+	})
+}
+
+// queueHandler 查看或管理下载队列
+// GET 返回正在执行和等待中的下载，DELETE 通过 ?id= 取消等待中的下载
+func queueHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		running, pending := jobs.snapshot()
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"max_concurrent": max(config.GetConfig().MaxConcurrent, 1),
+			"running":        running,
+			"pending":        pending,
+		})
+
+	case http.MethodDelete:
+		if !jobs.cancel(r.URL.Query().Get("id")) {
+			respondWithError(w, http.StatusNotFound, "队列中没有该下载，可能已经开始")
+			return
+		}
+		docker.UpdateMessage("已从队列中移除下载")
+		respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET或DELETE方法")
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/downloader"
+	"docker-cycler/pkg/urlpool"
+)
+
+// ratioMinDeficit 是触发补齐下载的最小缺口，避免为很少的流量频繁启动下载
+const ratioMinDeficit = 10 * 1024 * 1024
+
+// StartRatioKeeper 启动比例模式：定期检查网卡的收发量，下载量落后于目标比例时自动补齐
+// 网卡计数器由 netstat.StartMonitor 采样
+func StartRatioKeeper() {
+	ticker := time.NewTicker(30 * time.Second)
+
+	go func() {
+		for range ticker.C {
+			cfg := config.GetConfig()
+			if !cfg.RatioEnabled || cfg.RatioInterface == "" {
+				continue
+			}
+			keepRatio(cfg)
+		}
+	}()
+}
+
+// keepRatio 在今日下载量落后于目标比例时，用主任务的地址下载缺少的部分
+func keepRatio(cfg config.Config) {
+	if cfg.RatioTarget <= 0 {
+		return
+	}
+	deficit := docker.RatioDeficit(cfg.RatioInterface, cfg.RatioTarget)
+	if deficit < ratioMinDeficit {
+		return
+	}
+
+	task := cfg.MainTask()
+	if len(urlpool.Enabled(task.URLs)) == 0 || jobs.busy(task.ID) {
+		return
+	}
+	docker.CheckAndResetStats()
+	if _, blocked := startBlocked(cfg); blocked {
+		return
+	}
+
+	log.Printf("比例模式：距离目标下载:上传比还差 %d 字节，开始补齐", deficit)
+	jobs.enqueue(task, "ratio", priorityRatio, "比例补齐", func(opts *downloader.Options) {
+		// 只下载缺少的部分，避免超出目标比例
+		if opts.MaxBytes <= 0 || opts.MaxBytes > deficit {
+			opts.MaxBytes = deficit
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/downloader"
+	"docker-cycler/pkg/humanize"
+	"docker-cycler/pkg/urlpool"
+)
+
+// runDownload 执行某个任务的一次完整下载流程，label 用于区分手动下载和定时下载的提示信息
+// adjust 可在开始下载前修改下载参数，如限制本次的下载量
+func runDownload(cfg config.Config, task config.Task, label string, adjust ...func(*downloader.Options)) error {
+	if task.ID != config.MainTaskID {
+		label = "[" + task.Name + "]" + label
+	}
+
+	urlStr, err := urlpool.Pick(task)
+	if err != nil {
+		docker.RecordTaskResult(task.ID, false)
+		docker.UpdateMessage("%s失败: %v", label, err)
+		return err
+	}
+
+	docker.SetTaskStatus(task.ID, "下载中")
+	ctx := docker.NewDownloadContext(task.ID) // 为这次下载创建一个新的上下文
+
+	opts := downloadOptions(cfg, task, urlStr)
+	for _, fn := range adjust {
+		fn(&opts)
+	}
+
+	start := time.Now()
+	file, size, err := downloader.DownloadFileWithProgress(ctx, opts)
+
+	// 手动停止不代表地址不可用，不计入地址统计和任务的连续失败次数
+	if !errors.Is(err, downloader.ErrStopped) {
+		docker.RecordURLResult(urlStr, averageSpeedKB(size, time.Since(start)), err == nil)
+		docker.RecordTaskResult(task.ID, err == nil)
+	}
+
+	docker.RecordRun(err == nil || errors.Is(err, downloader.ErrStopped))
+
+	switch {
+	case errors.Is(err, downloader.ErrStopped):
+		docker.SetTaskStatus(task.ID, "已停止")
+		docker.UpdateMessage("%s已停止", label)
+		docker.UpdateLastDownloadInfo(file, false)
+	case err != nil:
+		docker.SetTaskStatus(task.ID, "失败")
+		docker.UpdateMessage("%s失败: %v", label, err)
+		docker.UpdateLastDownloadInfo(file, false)
+	default:
+		docker.SetTaskStatus(task.ID, "空闲")
+		docker.UpdateMessage("%s成功: %s", label, file)
+		docker.UpdateLastDownloadInfo(file, true)
+	}
+	return err
+}
+
+// startBlocked 检查当前是否允许开始下载，不允许时返回原因
+func startBlocked(cfg config.Config) (string, bool) {
+	if reason, closed := cfg.WindowClosed(time.Now().In(cfg.Location())); closed {
+		return reason, true
+	}
+	return docker.QuotaExhausted()
+}
+
+var (
+	// waitCancels 按任务ID保存开始下载前的等待（随机推迟或冷却）的取消函数
+	// 与下载上下文分开，等待期间开始的其他下载不会打断等待，等待也不会取消正在进行的下载
+	waitCancels     = make(map[string]context.CancelFunc)
+	waitCancelsLock sync.Mutex
+)
+
+// waitBeforeStart 在开始下载前等待一段时间，期间任务被手动停止时返回 false
+func waitBeforeStart(task config.Task, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	waitCancelsLock.Lock()
+	waitCancels[task.ID] = cancel
+	waitCancelsLock.Unlock()
+	defer func() {
+		waitCancelsLock.Lock()
+		delete(waitCancels, task.ID)
+		waitCancelsLock.Unlock()
+		cancel()
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		docker.SetTaskStatus(task.ID, "已停止")
+		docker.UpdateMessage("任务 %s 已停止", task.Name)
+		return false
+	}
+}
+
+// stopTask 停止任务：移除等待中的下载，取消开始前的等待，并停止正在进行的下载
+// taskID 为空时停止所有任务；先清空队列，避免停止后立即开始等待中的下载
+func stopTask(taskID string) {
+	jobs.cancelTask(taskID)
+	waitCancelsLock.Lock()
+	for id, cancel := range waitCancels {
+		if taskID == "" || id == taskID {
+			cancel()
+		}
+	}
+	waitCancelsLock.Unlock()
+	if taskID == "" {
+		docker.StopAllDownloads()
+	} else {
+		docker.StopDownload(taskID)
+	}
+}
+
+// startJitter 返回启用拟人化时任务定时触发后随机推迟的时间
+func startJitter(cfg config.Config, taskID string) time.Duration {
+	h := cfg.ActiveHumanize()
+	if h == nil || h.StartJitterSeconds <= 0 {
+		return 0
+	}
+	return humanize.Stream(h.Seed, taskID, humanize.PurposeStart).Duration(time.Duration(h.StartJitterSeconds) * time.Second)
+}
+
+// downloadOptions 根据当前配置、任务和选中的地址生成下载参数
+func downloadOptions(cfg config.Config, task config.Task, urlStr string) downloader.Options {
+	opts := downloader.Options{
+		TaskID:       task.ID,
+		URL:          urlStr,
+		SpeedKB:      task.SpeedKB,
+		SpeedProfile: cfg.ActiveSpeedProfile(),
+		Windows:      cfg.ActiveWindowList(),
+		PaceTarget:   cfg.PacingTargetBytes(),
+		Dir:          cfg.Dir,
+		Sink:         cfg.SinkMode,
+		Connections:  cfg.Connections,
+		Retry: downloader.RetryPolicy{
+			Count: cfg.RetryCount,
+			Delay: time.Duration(cfg.RetryDelaySeconds) * time.Second,
+		},
+		MaxBytes:    int64(cfg.RunLimitMB) * 1024 * 1024,
+		MaxDuration: time.Duration(cfg.RunLimitMinutes) * time.Minute,
+	}
+
+	if h := cfg.ActiveHumanize(); h != nil {
+		opts.Humanize = h
+		// 每次的下载量在范围内随机，同时设置了单次下载上限时取较小的一个
+		if h.RunMaxMB > 0 {
+			limit := humanize.Stream(h.Seed, task.ID, humanize.PurposeRun).Between(int64(max(h.RunMinMB, 1)), int64(h.RunMaxMB)) * 1024 * 1024
+			if opts.MaxBytes <= 0 || limit < opts.MaxBytes {
+				opts.MaxBytes = limit
+			}
+		}
+	}
+	return opts
+}
+
+// averageSpeedKB 计算平均下载速度（KB/s）
+func averageSpeedKB(bytes int, elapsed time.Duration) int {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int(float64(bytes) / 1024 / elapsed.Seconds())
+}
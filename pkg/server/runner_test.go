@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/humanize"
+)
+
+func humanizeConfig(seed int64) config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Humanize = config.Humanize{
+		Enabled:            true,
+		Seed:               seed,
+		StartJitterSeconds: 600,
+		RunMinMB:           10,
+		RunMaxMB:           500,
+	}
+	return cfg
+}
+
+// humanizeDraws 返回任务依次得到的随机推迟时间和随机下载量，other 不为空时穿插另一个任务的取值
+func humanizeDraws(cfg config.Config, task, other config.Task, n int) ([]time.Duration, []int64) {
+	var jitters []time.Duration
+	var caps []int64
+	for i := 0; i < n; i++ {
+		if other.ID != "" {
+			startJitter(cfg, other.ID)
+			downloadOptions(cfg, other, "http://example.com/other")
+		}
+		jitters = append(jitters, startJitter(cfg, task.ID))
+		caps = append(caps, downloadOptions(cfg, task, "http://example.com/file").MaxBytes)
+	}
+	return jitters, caps
+}
+
+func TestHumanizeReproducible(t *testing.T) {
+	cfg := humanizeConfig(99)
+	task := config.Task{ID: "task_a"}
+	humanize.Reset()
+	jitters, caps := humanizeDraws(cfg, task, config.Task{}, 20)
+
+	// 从头开始，穿插另一个任务的取值
+	humanize.Reset()
+	jitters2, caps2 := humanizeDraws(cfg, task, config.Task{ID: "task_b"}, 20)
+
+	for i := range jitters {
+		if jitters[i] != jitters2[i] || caps[i] != caps2[i] {
+			t.Fatalf("第 %d 次: 推迟 %v/%v，下载量 %d/%d", i+1, jitters[i], jitters2[i], caps[i], caps2[i])
+		}
+		if jitters[i] < 0 || jitters[i] > 600*time.Second {
+			t.Fatalf("推迟时间 %v 超出范围", jitters[i])
+		}
+		if caps[i] < 10<<20 || caps[i] > 500<<20 {
+			t.Fatalf("下载量 %d 超出范围", caps[i])
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package server
 
 import (
+	"fmt"
+	"hash/fnv"
 	"log"
+	"sync"
 	"time"
 
 	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/cron"
 	"docker-cycler/pkg/docker"
-	"docker-cycler/pkg/downloader"
+	"docker-cycler/pkg/humanize"
+	"docker-cycler/pkg/urlpool"
 )
 
 // StartScheduler 启动一个goroutine来处理定时下载任务
@@ -15,80 +20,259 @@ func StartScheduler() {
 	ticker := time.NewTicker(30 * time.Second) // 每30秒检查一次是否需要执行任务
 
 	go func() {
+		// 启动后立即检查一次，使错过的执行尽快补跑，并更新下次执行时间
+		checkTasks()
 		for range ticker.C {
-			status := docker.GetAppStatus()
-			if !status.TaskEnabled {
-				continue
-			}
-
-			// 检查并重置每日/每月统计数据
-			docker.CheckAndResetStats()
-
-			cfg := config.GetConfig()
-			if cfg.URL == "" {
-				continue // 没有URL，跳过
-			}
-
-			if shouldDownload(cfg) {
-				// 避免在已有下载时启动新下载
-				if docker.GetTaskStatus() == "下载中" {
-					log.Println("调度器：检测到已有下载任务，本次跳过")
-					continue
-				}
-
-				// 检查下载限制 - 使用配置文件中的设置
-				if cfg.DailyLimitEnabled && status.Stats.DailyDownloadedMB >= cfg.LimitMB {
-					docker.UpdateMessage("调度器：今日下载量已达上限，任务跳过")
-					continue
-				}
-
-				// 启动下载
-				go func() {
-					docker.SetTaskStatus("下载中")
-					docker.NewDownloadContext() // 为定时任务创建一个新的上下文
-
-					file, size, err := downloader.DownloadFileWithProgress(docker.GetDownloadContext(), cfg.URL, cfg.SpeedKB, cfg.Dir)
-					if err != nil {
-						docker.SetTaskStatus("失败")
-						docker.UpdateMessage("定时下载失败: %v", err)
-						docker.UpdateLastDownloadInfo(file, false)
-					} else {
-						docker.SetTaskStatus("空闲")
-						docker.UpdateMessage("定时下载成功: %s", file)
-						docker.UpdateLastDownloadInfo(file, true)
-						docker.AddDownloadStats(size)
-					}
-				}()
-			}
+			checkTasks()
 		}
 	}()
 }
 
-// lastTriggered 用于跟踪周期性任务的最后触发时间
-var lastTriggered time.Time
+// checkTasks 检查所有任务，启动到期的下载并更新各任务的下次执行时间
+func checkTasks() {
+	// 检查并重置每日/每月统计数据
+	docker.CheckAndResetStats()
 
-// shouldDownload 判断当前时间是否满足下载条件
-func shouldDownload(cfg config.Config) bool {
-	now := time.Now()
-	switch cfg.PlanType {
+	cfg := config.GetConfig()
+	for _, task := range cfg.AllTasks() {
+		checkTask(cfg, task)
+	}
+	refreshNextDue()
+}
+
+// refreshNextDue 重新计算所有任务的下次执行时间，修改计划后调用使其立即反映在状态中
+func refreshNextDue() {
+	now := config.Now()
+	for _, task := range config.GetConfig().AllTasks() {
+		var next time.Time
+		if task.Enabled {
+			next = nextDue(task, now)
+		}
+		docker.SetNextDue(task.ID, next)
+	}
+}
+
+// checkTask 检查单个任务是否到期，到期且允许下载时启动下载
+func checkTask(cfg config.Config, task config.Task) {
+	if !task.Enabled {
+		return
+	}
+	if len(urlpool.Enabled(task.URLs)) == 0 {
+		return // 没有可用的URL，跳过
+	}
+	if jitterPending(task.ID) {
+		return // 正在随机推迟，等待开始
+	}
+	// 避免同一任务重复下载，排队中和暂停中的下载也算在内；到期的执行等下载结束后再处理
+	if jobs.busy(task.ID) {
+		return
+	}
+	due, ok := shouldDownload(task)
+	if !ok {
+		return
+	}
+
+	// 检查允许时段和下载限制，下载过程中额度用完也会自动停止
+	// 不记录触发时间，到期的执行（包括补跑）在允许下载后继续进行
+	if reason, blocked := startBlocked(cfg); blocked {
+		// 被阻止期间每次检查都满足条件，只在第一次跳过时提示
+		if docker.GetTaskStatus(task.ID) != "已跳过" {
+			docker.UpdateMessage("调度器：%s，任务 %s 跳过", reason, task.Name)
+		}
+		docker.SetTaskStatus(task.ID, "已跳过")
+		return
+	}
+
+	if !due.at.IsZero() {
+		docker.SetLastTriggered(task.ID, due.at)
+	}
+	if due.note != "" {
+		docker.UpdateMessage("调度器：%s", due.note)
+	}
+
+	// 启动下载
+	if task.PlanType == "continuous" {
+		go runContinuous(task)
+	} else {
+		go runScheduled(cfg, task)
+	}
+}
+
+// runScheduled 将到期的定时任务加入下载队列，启用拟人化时先随机推迟一段时间
+// 推迟期间已被手动启动的任务由队列去重，开始下载时队列会再检查允许时段和下载限制
+func runScheduled(cfg config.Config, task config.Task) {
+	if delay := startJitter(cfg, task.ID); delay > 0 {
+		delayedLock.Lock()
+		delayed[task.ID] = true
+		delayedLock.Unlock()
+		defer func() {
+			delayedLock.Lock()
+			delete(delayed, task.ID)
+			delayedLock.Unlock()
+		}()
+
+		docker.UpdateMessage("调度器：任务 %s 将在 %s 后开始", task.Name, delay.Round(time.Second))
+		if !waitBeforeStart(task, delay) {
+			return
+		}
+	}
+	jobs.enqueue(task, "schedule", prioritySchedule, "定时下载")
+}
+
+var (
+	// delayed 记录触发后正在随机推迟的任务
+	delayed     = make(map[string]bool)
+	delayedLock sync.Mutex
+)
+
+// jitterPending 判断任务是否正在随机推迟
+func jitterPending(taskID string) bool {
+	delayedLock.Lock()
+	defer delayedLock.Unlock()
+	return delayed[taskID]
+}
+
+// trigger 是一次到期的执行，开始下载时将 at 记为触发时间（零值表示不记录）并显示 note
+type trigger struct {
+	at   time.Time
+	note string
+}
+
+// shouldDownload 判断当前时间是否满足任务的下载条件，返回开始下载时要记录的触发
+// 触发时间保存在调度状态中，重启后间隔执行不会立即触发，同一分钟也不会重复触发
+func shouldDownload(task config.Task) (trigger, bool) {
+	now := config.Now()
+	last := docker.LastTriggered(task.ID).In(now.Location())
+	switch task.PlanType {
 	case "daily":
-		// 检查是否在设定的分钟内
-		if now.Hour() == cfg.Hour && now.Minute() == cfg.Minute {
-			// 为了避免在同一分钟内重复触发，我们检查自上次触发以来是否已超过一分钟
-			if time.Since(lastTriggered) > time.Minute {
-				lastTriggered = now
-				return true
-			}
+		return dailyDue(task, now)
+	case "cron":
+		sched, err := cron.Parse(task.CronExpr)
+		if err != nil {
+			return trigger{}, false
 		}
+		// 与每日执行相同，避免在同一分钟内重复触发
+		if sched.Matches(now) && now.Sub(last) > time.Minute {
+			return trigger{at: now}, true
+		}
+	case "continuous":
+		// 手动停止后不再自动开始，直到再次手动下载
+		return trigger{}, !cycleActive(task.ID) && docker.GetTaskStatus(task.ID) != "已停止"
 	case "interval":
-		if cfg.IntervalMinutes <= 0 {
-			return false
+		if task.IntervalMinutes <= 0 {
+			return trigger{}, false
 		}
 		// 检查自上次触发以来是否已超过设定的间隔
-		if time.Since(lastTriggered) > time.Duration(cfg.IntervalMinutes)*time.Minute {
-			lastTriggered = now
-			return true
+		if now.Sub(last) > time.Duration(task.IntervalMinutes)*time.Minute {
+			return trigger{at: now}, true
+		}
+	}
+	return trigger{}, false
+}
+
+// nextDue 返回任务在 now 之后（或已到期未执行时）的计划执行时间，没有固定计划时返回零值
+func nextDue(task config.Task, now time.Time) time.Time {
+	// 保存的时间带有固定的时差，转换到配置的时区后再按日历计算
+	last := docker.LastTriggered(task.ID).In(now.Location())
+	switch task.PlanType {
+	case "daily":
+		return nextDaily(task, dailyBaseline(last, now))
+	case "cron":
+		sched, err := cron.Parse(task.CronExpr)
+		if err != nil {
+			return time.Time{}
 		}
+		// 本分钟已触发过时从下一分钟开始找
+		from := now.Add(-time.Minute)
+		if last.After(from) {
+			from = last
+		}
+		return sched.Next(from)
+	case "interval":
+		if task.IntervalMinutes <= 0 {
+			return time.Time{}
+		}
+		if last.IsZero() {
+			return now
+		}
+		return last.Add(time.Duration(task.IntervalMinutes) * time.Minute)
+	}
+	// 持续下载没有固定的执行时间
+	return time.Time{}
+}
+
+const (
+	// dailyGrace 是每日执行允许的延迟，超过后视为错过，按补跑策略处理
+	dailyGrace = time.Minute
+	// maxCatchUpDays 是 "all" 策略最多补跑的天数，避免长时间停机后连续下载
+	maxCatchUpDays = 7
+)
+
+// dailyDue 判断每日执行的任务是否到期
+// 上次触发后的计划时间已过但超过 dailyGrace 时视为错过，按任务的补跑策略决定是否执行
+// 补跑只在真正开始下载时记录，被下载限制或允许时段阻止时保留到允许下载之后
+func dailyDue(task config.Task, now time.Time) (trigger, bool) {
+	due := nextDaily(task, dailyBaseline(docker.LastTriggered(task.ID).In(now.Location()), now))
+	if due.After(now) {
+		return trigger{}, false
+	}
+	if now.Sub(due) <= dailyGrace {
+		return trigger{at: now}, true
+	}
+
+	switch task.CatchUp {
+	case "once":
+		// 无论错过多少次，只补跑一次
+		return trigger{
+			at:   now,
+			note: fmt.Sprintf("任务 %s 错过了 %s 的执行，现在补跑", task.Name, due.Format("01-02 15:04")),
+		}, true
+	case "all":
+		// 每次补跑最早错过的一次，直到追上当前时间
+		if earliest := now.AddDate(0, 0, -maxCatchUpDays); due.Before(earliest) {
+			due = nextDaily(task, earliest)
+		}
+		return trigger{
+			at:   due,
+			note: fmt.Sprintf("任务 %s 补跑 %s 的执行", task.Name, due.Format("01-02 15:04")),
+		}, true
+	default:
+		// 不补跑时没有要下载的内容，直接记录
+		docker.SetLastTriggered(task.ID, now)
+		docker.UpdateMessage("调度器：任务 %s 错过了 %s 的执行，已跳过", task.Name, due.Format("01-02 15:04"))
+		return trigger{}, false
+	}
+}
+
+// dailyBaseline 返回计算下一次每日执行的起点，从未触发过的任务没有可补跑的记录，只在计划时间执行
+func dailyBaseline(last, now time.Time) time.Time {
+	if last.IsZero() {
+		return now.Add(-dailyGrace)
+	}
+	return last
+}
+
+// nextDaily 返回 after 之后任务的第一次计划执行时间，包括随机偏移
+func nextDaily(task config.Task, after time.Time) time.Time {
+	// 随机偏移可能使前一天的执行落在 after 所在的这一天
+	day := time.Date(after.Year(), after.Month(), after.Day()-1, 0, 0, 0, 0, after.Location())
+	for {
+		at := time.Date(day.Year(), day.Month(), day.Day(), task.Hour, task.Minute, 0, 0, day.Location()).
+			Add(dailyJitter(task, day))
+		if at.After(after) {
+			return at
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
+
+// dailyJitter 返回任务在 day 这一天的随机偏移，同一任务同一天的偏移固定，重启后也不会变化
+func dailyJitter(task config.Task, day time.Time) time.Duration {
+	if task.JitterMinutes <= 0 {
+		return 0
 	}
-	return false
+	h := fnv.New64a()
+	h.Write([]byte(task.ID + "@" + day.Format("2006-01-02")))
+	jitter := int64(min(task.JitterMinutes, config.MaxJitterMinutes)) * 60
+	return time.Duration(humanize.New(int64(h.Sum64()|1)).Between(-jitter, jitter)) * time.Second
 }
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/cron"
+	"docker-cycler/pkg/docker"
+	"docker-cycler/pkg/urlpool"
+)
+
+// taskView 是任务列表中的一项，附带任务的运行状态
+type taskView struct {
+	config.Task
+	Runtime docker.TaskRuntime `json:"runtime"`
+}
+
+// tasksHandler 管理下载任务
+// GET 返回所有任务（包括主任务），POST 新建任务，PUT/DELETE 通过 ?id= 修改或删除自定义任务
+func tasksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg := config.GetConfig()
+		tasks := cfg.AllTasks()
+		views := make([]taskView, len(tasks))
+		for i, t := range tasks {
+			views[i] = taskView{Task: t, Runtime: docker.GetTaskRuntime(t.ID)}
+		}
+		respondWithJSON(w, http.StatusOK, views)
+
+	case http.MethodPost:
+		task, ok := decodeTask(w, r)
+		if !ok {
+			return
+		}
+		task, err := config.AddTask(task)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "保存任务失败: "+err.Error())
+			return
+		}
+		refreshNextDue()
+		docker.UpdateMessage("已添加任务: %s", task.Name)
+		respondWithJSON(w, http.StatusCreated, task)
+
+	case http.MethodPut:
+		id, ok := customTaskID(w, r)
+		if !ok {
+			return
+		}
+		task, ok := decodeTask(w, r)
+		if !ok {
+			return
+		}
+		task.ID = id
+		if err := config.UpdateTask(task); err != nil {
+			respondWithTaskError(w, err)
+			return
+		}
+		refreshNextDue()
+		docker.UpdateMessage("已更新任务: %s", task.Name)
+		respondWithJSON(w, http.StatusOK, task)
+
+	case http.MethodDelete:
+		id, ok := customTaskID(w, r)
+		if !ok {
+			return
+		}
+		if err := config.DeleteTask(id); err != nil {
+			respondWithTaskError(w, err)
+			return
+		}
+		docker.ForgetTask(id)
+		docker.UpdateMessage("已删除任务")
+		respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许GET、POST、PUT或DELETE方法")
+	}
+}
+
+// taskRunHandler 立即执行指定任务一次
+func taskRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许POST方法")
+		return
+	}
+	task, ok := config.GetTask(r.URL.Query().Get("id"))
+	if !ok {
+		respondWithError(w, http.StatusNotFound, config.ErrTaskNotFound.Error())
+		return
+	}
+	// 开始时再检查允许时段和下载限制，下载过程中额度用完也会自动停止
+	enqueueManual(task)
+	respondWithJSON(w, http.StatusAccepted, docker.GetTaskRuntime(task.ID))
+}
+
+// taskStopHandler 停止指定任务当前的下载
+func taskStopHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "只允许POST方法")
+		return
+	}
+	task, ok := config.GetTask(r.URL.Query().Get("id"))
+	if !ok {
+		respondWithError(w, http.StatusNotFound, config.ErrTaskNotFound.Error())
+		return
+	}
+	stopTask(task.ID)
+	docker.UpdateMessage("已向任务 %s 发送停止信号", task.Name)
+	respondWithJSON(w, http.StatusOK, docker.GetTaskRuntime(task.ID))
+}
+
+// enqueueManual 将手动下载加入队列，任务正在下载时排在当前下载之后
+func enqueueManual(task config.Task) {
+	if _, added := jobs.enqueue(task, "manual", priorityManual, "下载"); !added {
+		docker.UpdateMessage("任务 %s 已在下载队列中", task.Name)
+		return
+	}
+	docker.UpdateMessage("任务 %s 已加入下载队列", task.Name)
+}
+
+// customTaskID 读取 ?id= 参数，主任务只能通过 /api/set 修改
+func customTaskID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondWithError(w, http.StatusBadRequest, "缺少任务ID")
+		return "", false
+	}
+	if id == config.MainTaskID {
+		respondWithError(w, http.StatusBadRequest, "主任务请通过设置页面修改")
+		return "", false
+	}
+	return id, true
+}
+
+// decodeTask 解析并校验请求体中的任务
+func decodeTask(w http.ResponseWriter, r *http.Request) (config.Task, bool) {
+	var task config.Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		respondWithError(w, http.StatusBadRequest, "无效的任务数据: "+err.Error())
+		return task, false
+	}
+	if err := validateTask(&task); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return task, false
+	}
+	return task, true
+}
+
+// validateTask 校验任务参数并填充默认值
+func validateTask(task *config.Task) error {
+	task.Name = strings.TrimSpace(task.Name)
+	if task.Name == "" {
+		return errors.New("任务名称不能为空")
+	}
+
+	urls := task.URLs[:0]
+	for _, u := range task.URLs {
+		u.URL = strings.TrimSpace(u.URL)
+		if u.URL == "" {
+			continue
+		}
+		if u.Weight <= 0 {
+			u.Weight = 1
+		}
+		urls = append(urls, u)
+	}
+	task.URLs = urls
+	if len(task.URLs) == 0 {
+		return errors.New("至少需要一个下载地址")
+	}
+
+	if task.URLStrategy == "" {
+		task.URLStrategy = "round_robin"
+	}
+	if !urlpool.ValidStrategy(task.URLStrategy) {
+		return errors.New("不支持的URL选择策略: " + task.URLStrategy)
+	}
+
+	switch task.PlanType {
+	case "daily":
+		if task.Hour < 0 || task.Hour > 23 || task.Minute < 0 || task.Minute > 59 {
+			return errors.New("无效的执行时间")
+		}
+		if task.JitterMinutes < 0 || task.JitterMinutes > config.MaxJitterMinutes {
+			return errors.New("随机偏移必须在 0 到 720 分钟之间")
+		}
+		if task.CatchUp == "" {
+			task.CatchUp = "skip"
+		}
+		if !config.ValidCatchUp(task.CatchUp) {
+			return errors.New("不支持的补跑策略: " + task.CatchUp)
+		}
+	case "interval":
+		if task.IntervalMinutes <= 0 {
+			return errors.New("执行间隔必须大于0")
+		}
+	case "cron":
+		task.CronExpr = strings.TrimSpace(task.CronExpr)
+		if _, err := cron.Parse(task.CronExpr); err != nil {
+			return errors.New("cron 表达式无效: " + err.Error())
+		}
+	case "continuous":
+		if task.CooldownSeconds < 0 {
+			return errors.New("冷却时间不能为负数")
+		}
+	default:
+		return errors.New("不支持的计划类型: " + task.PlanType)
+	}
+
+	if task.SpeedKB < 0 {
+		return errors.New("限速不能为负数")
+	}
+	return nil
+}
+
+// respondWithTaskError 将任务操作的错误转换为对应的HTTP状态码
+func respondWithTaskError(w http.ResponseWriter, err error) {
+	if errors.Is(err, config.ErrTaskNotFound) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "保存任务失败: "+err.Error())
+}
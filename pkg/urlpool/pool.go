@@ -0,0 +1,140 @@
+package urlpool
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+)
+
+// failoverCooldown 是故障转移策略中失败地址被跳过的时间
+const failoverCooldown = 10 * time.Minute
+
+// ErrNoURL 表示没有可用的下载地址
+var ErrNoURL = errors.New("未设置下载地址")
+
+var (
+	// 轮询策略中每个任务的下一个位置
+	rrIndex = make(map[string]int)
+	rrLock  sync.Mutex
+)
+
+// ValidStrategy 判断策略名称是否受支持
+func ValidStrategy(strategy string) bool {
+	switch strategy {
+	case "round_robin", "weighted", "fastest", "failover":
+		return true
+	}
+	return false
+}
+
+// Enabled 返回所有已启用且地址非空的条目
+func Enabled(entries []config.URLEntry) []config.URLEntry {
+	var result []config.URLEntry
+	for _, e := range entries {
+		if e.Enabled && e.URL != "" {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Pick 按照任务的策略从其地址列表中选择本次使用的下载地址，并记录选择原因
+func Pick(task config.Task) (string, error) {
+	candidates := Enabled(task.URLs)
+	strategy := task.URLStrategy
+	if len(candidates) == 0 {
+		return "", ErrNoURL
+	}
+
+	var urlStr, reason string
+	switch {
+	case len(candidates) == 1:
+		urlStr, reason = candidates[0].URL, "只有一个可用地址"
+	case strategy == "weighted":
+		urlStr, reason = pickWeighted(candidates)
+	case strategy == "fastest":
+		urlStr, reason = pickFastest(candidates, docker.GetURLStats())
+	case strategy == "failover":
+		urlStr, reason = pickFailover(candidates, docker.GetURLStats())
+	default:
+		urlStr, reason = pickRoundRobin(task.ID, candidates)
+	}
+	recordPick(task.Name, urlStr, strategy, reason)
+	return urlStr, nil
+}
+
+// pickRoundRobin 依次轮流使用每个地址
+func pickRoundRobin(taskID string, candidates []config.URLEntry) (string, string) {
+	rrLock.Lock()
+	defer rrLock.Unlock()
+	idx := rrIndex[taskID] % len(candidates)
+	rrIndex[taskID] = (idx + 1) % len(candidates)
+	return candidates[idx].URL, fmt.Sprintf("轮询第 %d/%d 个地址", idx+1, len(candidates))
+}
+
+// pickWeighted 按权重随机选择，权重 <= 0 视为 1
+func pickWeighted(candidates []config.URLEntry) (string, string) {
+	total := 0
+	for _, e := range candidates {
+		total += weightOf(e)
+	}
+	n := rand.Intn(total)
+	for _, e := range candidates {
+		n -= weightOf(e)
+		if n < 0 {
+			return e.URL, fmt.Sprintf("加权随机（权重 %d/%d）", weightOf(e), total)
+		}
+	}
+	e := candidates[len(candidates)-1]
+	return e.URL, fmt.Sprintf("加权随机（权重 %d/%d）", weightOf(e), total)
+}
+
+func weightOf(e config.URLEntry) int {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// pickFastest 优先选择测速最快的地址；没有测速结果时参考历史下载速度，
+// 尚未使用过的地址优先使用以获得速度数据
+func pickFastest(candidates []config.URLEntry, stats map[string]docker.URLStat) (string, string) {
+	if r, ok := fastestProbed(candidates); ok {
+		return r.URL, fmt.Sprintf("测速最快（%d KB/s，首字节 %d ms）", r.SpeedKB, r.TTFBMs)
+	}
+
+	best := ""
+	bestSpeed := -1
+	for _, e := range candidates {
+		st, ok := stats[e.URL]
+		if !ok || st.Runs == 0 {
+			return e.URL, "尚无速度数据，优先尝试"
+		}
+		if st.LastSpeedKB > bestSpeed {
+			best = e.URL
+			bestSpeed = st.LastSpeedKB
+		}
+	}
+	return best, fmt.Sprintf("历史下载最快（%d KB/s）", bestSpeed)
+}
+
+// pickFailover 按列表顺序使用第一个健康的地址
+// 连续失败的地址在冷却时间内会被跳过，全部失败时回到第一个地址
+func pickFailover(candidates []config.URLEntry, stats map[string]docker.URLStat) (string, string) {
+	now := time.Now()
+	for i, e := range candidates {
+		st := stats[e.URL]
+		if st.ConsecutiveFailures == 0 || now.Sub(st.LastFailure) > failoverCooldown {
+			if i == 0 {
+				return e.URL, "主地址可用"
+			}
+			return e.URL, fmt.Sprintf("前 %d 个地址近期失败，切换到第 %d 个", i, i+1)
+		}
+	}
+	return candidates[0].URL, "所有地址近期均失败，回到主地址"
+}
@@ -0,0 +1,246 @@
+package urlpool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"docker-cycler/pkg/config"
+	"docker-cycler/pkg/docker"
+)
+
+const (
+	// probeTimeout 是单个地址测速的最长时间
+	probeTimeout = 15 * time.Second
+	// defaultProbeSize 是未设置测速数据量时每个地址下载的字节数
+	defaultProbeSize = 1024 * 1024
+)
+
+// MirrorResult 保存一次镜像测速的结果
+type MirrorResult struct {
+	URL      string    `json:"url"`
+	Rank     int       `json:"rank"`     // 按速度排名，从 1 开始，失败的地址为 0
+	SpeedKB  int       `json:"speed_kb"` // 测速期间的下载速度 KB/s
+	TTFBMs   int64     `json:"ttfb_ms"`  // 首字节时间（毫秒）
+	Bytes    int64     `json:"bytes"`
+	Error    string    `json:"error,omitempty"`
+	ProbedAt time.Time `json:"probed_at"`
+}
+
+// PickInfo 记录最近一次选择下载地址的原因
+type PickInfo struct {
+	Task     string    `json:"task"`
+	URL      string    `json:"url"`
+	Strategy string    `json:"strategy"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"time"`
+}
+
+// MirrorStatus 是 /api/mirrors 返回的内容
+type MirrorStatus struct {
+	Results   []MirrorResult `json:"results"`
+	LastPick  PickInfo       `json:"last_pick"`
+	LastProbe time.Time      `json:"last_probe"`
+	Probing   bool           `json:"probing"`
+}
+
+var (
+	probeResults map[string]MirrorResult
+	lastProbe    time.Time
+	probing      bool
+	lastPick     PickInfo
+	probeLock    sync.RWMutex
+)
+
+// StartProber 启动一个goroutine按配置的间隔定期对所有地址测速
+func StartProber() {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for range ticker.C {
+			cfg := config.GetConfig()
+			if cfg.ProbeIntervalMinutes <= 0 {
+				continue
+			}
+			probeLock.RLock()
+			due := time.Since(lastProbe) >= time.Duration(cfg.ProbeIntervalMinutes)*time.Minute
+			probeLock.RUnlock()
+			if !due {
+				continue
+			}
+			// 测速会与正在进行的下载争抢带宽，影响结果
+			if docker.AnyDownloading() {
+				continue
+			}
+			if _, blocked := ProbeBlocked(cfg); blocked {
+				continue
+			}
+			ProbeAll(cfg)
+		}
+	}()
+}
+
+// ProbeBlocked 判断当前是否不允许测速并返回原因
+// 测速同样消耗流量，不在允许的时段内或下载额度已用完时不测速
+func ProbeBlocked(cfg config.Config) (string, bool) {
+	if reason, closed := cfg.WindowClosed(time.Now().In(cfg.Location())); closed {
+		return reason, true
+	}
+	return docker.QuotaExhausted()
+}
+
+// ProbeAll 依次对所有任务中已启用的地址进行测速并更新排名
+func ProbeAll(cfg config.Config) {
+	probeLock.Lock()
+	if probing {
+		probeLock.Unlock()
+		return
+	}
+	probing = true
+	probeLock.Unlock()
+
+	// 所有任务的地址一起测速，相同的地址只测一次
+	results := make(map[string]MirrorResult)
+tasks:
+	for _, task := range cfg.AllTasks() {
+		for _, e := range Enabled(task.URLs) {
+			if _, ok := results[e.URL]; ok {
+				continue
+			}
+			// 测速的流量计入下载量，额度不足时减少测速的数据量，用完后停止测速
+			size := int64(cfg.ProbeSizeKB) * 1024
+			if size <= 0 {
+				size = defaultProbeSize
+			}
+			if remaining, reason := docker.RemainingQuota(); reason != "" {
+				if remaining <= 0 {
+					log.Printf("%s，停止镜像测速", reason)
+					break tasks
+				}
+				size = min(size, remaining)
+			}
+			res := probe(e.URL, size)
+			if res.Bytes > 0 {
+				docker.AddDownloadStats(int(res.Bytes))
+			}
+			if res.Error != "" {
+				log.Printf("镜像测速失败 %s: %s", e.URL, res.Error)
+			}
+			results[e.URL] = res
+		}
+	}
+
+	probeLock.Lock()
+	defer probeLock.Unlock()
+	probeResults = results
+	lastProbe = time.Now()
+	probing = false
+	log.Printf("镜像测速完成，共 %d 个地址", len(results))
+}
+
+// probe 对单个地址做一次限定字节数的计时下载
+func probe(urlStr string, size int64) MirrorResult {
+	if size <= 0 {
+		size = defaultProbeSize
+	}
+	res := MirrorResult{URL: urlStr, ProbedAt: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", size-1))
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	res.TTFBMs = time.Since(start).Milliseconds()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		res.Error = fmt.Sprintf("HTTP状态码: %d", resp.StatusCode)
+		return res
+	}
+
+	// 服务器不支持 Range 时也只读取指定的字节数
+	bodyStart := time.Now()
+	n, err := io.CopyN(io.Discard, resp.Body, size)
+	res.Bytes = n
+	if err != nil && err != io.EOF && n == 0 {
+		res.Error = err.Error()
+		return res
+	}
+	if elapsed := time.Since(bodyStart).Seconds(); elapsed > 0 {
+		res.SpeedKB = int(float64(n) / 1024 / elapsed)
+	}
+	return res
+}
+
+// GetMirrorStatus 返回按速度排序的测速结果和最近一次选择的原因
+func GetMirrorStatus() MirrorStatus {
+	probeLock.RLock()
+	defer probeLock.RUnlock()
+
+	results := make([]MirrorResult, 0, len(probeResults))
+	for _, r := range probeResults {
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Error == "") != (results[j].Error == "") {
+			return results[i].Error == ""
+		}
+		if results[i].SpeedKB != results[j].SpeedKB {
+			return results[i].SpeedKB > results[j].SpeedKB
+		}
+		return results[i].TTFBMs < results[j].TTFBMs
+	})
+	for i := range results {
+		if results[i].Error == "" {
+			results[i].Rank = i + 1
+		}
+	}
+
+	return MirrorStatus{
+		Results:   results,
+		LastPick:  lastPick,
+		LastProbe: lastProbe,
+		Probing:   probing,
+	}
+}
+
+// fastestProbed 返回候选地址中测速最快的一个
+func fastestProbed(candidates []config.URLEntry) (MirrorResult, bool) {
+	probeLock.RLock()
+	defer probeLock.RUnlock()
+	var best MirrorResult
+	found := false
+	for _, e := range candidates {
+		r, ok := probeResults[e.URL]
+		if !ok || r.Error != "" {
+			continue
+		}
+		if !found || r.SpeedKB > best.SpeedKB {
+			best = r
+			found = true
+		}
+	}
+	return best, found
+}
+
+// recordPick 记录本次选择的地址和原因
+func recordPick(task, urlStr, strategy, reason string) {
+	probeLock.Lock()
+	defer probeLock.Unlock()
+	lastPick = PickInfo{Task: task, URL: urlStr, Strategy: strategy, Reason: reason, Time: time.Now()}
+}
@@ -5,9 +5,45 @@ $(document).ready(function () {
     // 启动定期状态刷新（每5秒），但只刷新状态，不刷新配置
     setInterval(autoLoadStatus, 5000);
 
+    // 镜像测速结果刷新
+    loadMirrors();
+    setInterval(loadMirrors, 10000);
+
+    // 比例模式可选的网卡
+    loadInterfaces();
+
+    // 下载任务列表刷新
+    loadTasks();
+    setInterval(loadTasks, 2000);
+
+    // 下载队列刷新
+    loadQueue();
+    setInterval(loadQueue, 2000);
+
+    // 流量历史图表，默认显示最近30天
+    const today = new Date();
+    $('#historyTo').val(formatDate(today));
+    $('#historyFrom').val(formatDate(new Date(today.getTime() - 29 * 86400000)));
+    loadHistory();
+    setInterval(loadHistory, 60000);
+    $(window).on('resize', () => {
+        renderHistory();
+        renderSparkline();
+    });
+
+    // 没有下载时速度记为0，使速度曲线持续滚动
+    setInterval(() => {
+        if (!progressTimer) {
+            recordSpeed(0);
+        }
+    }, 1000);
+
     // 绑定表单提交事件
     $('#setForm').on('submit', function (e) {
         e.preventDefault();
+        $('#urlsInput').val(JSON.stringify(collectUrls()));
+        $('#speedProfileInput').val(JSON.stringify(speedProfile));
+        $('#activeWindowsInput').val(JSON.stringify(collectWindows()));
         var fd = new FormData(this);
         $.ajax({
             url: '/api/set',
@@ -28,6 +64,27 @@ $(document).ready(function () {
 
     // 绑定计划类型切换事件
     $('#planType').on('change', togglePlanType);
+    $('#taskPlan').on('change', toggleTaskPlan);
+
+    // 速度计划表格
+    renderSpeedGrid();
+    $('#speedBrushType').on('change', function () {
+        $('#speedBrushValue').toggleClass('d-none', $(this).val() !== 'limited');
+    }).trigger('change');
+    $(document).on('mouseup', () => { speedPainting = false; });
+
+    // 保存任务
+    $('#taskForm').on('submit', function (e) {
+        e.preventDefault();
+        saveTask();
+    });
+
+    // 输入 cron 表达式时预览接下来的执行时间
+    let cronTimer = null;
+    $('#cronInput').on('input', function () {
+        clearTimeout(cronTimer);
+        cronTimer = setTimeout(previewCron, 400);
+    });
 });
 
 // --- 消息提示功能 ---
@@ -180,6 +237,491 @@ function toggleLimit() {
     });
 }
 
+// 立即对所有地址测速
+function probeMirrors() {
+    $.post('/api/mirrors', function (data) {
+        renderMirrors(data);
+        showMessage('镜像测速已启动', 'success');
+        setTimeout(loadMirrors, 3000);
+    }).fail(function (jqXHR) {
+        showMessage(jqXHR.responseJSON ? jqXHR.responseJSON.error : '启动测速失败', 'error');
+    });
+}
+
+// --- 镜像测速 ---
+
+function loadMirrors() {
+    $.getJSON('/api/mirrors', renderMirrors);
+}
+
+function renderMirrors(data) {
+    if (!data) return;
+
+    const pick = data.last_pick || {};
+    $('#lastPickText').text(pick.url ? `${pick.url}（${pick.reason}）` : '-');
+
+    let probeText = data.last_probe && !data.last_probe.startsWith('0001') ? formatTime(data.last_probe) : '-';
+    if (data.probing) {
+        probeText += '（测速中...）';
+    }
+    $('#lastProbeText').text(probeText);
+
+    const list = $('#mirrorList').empty();
+    const results = data.results || [];
+    if (results.length === 0) {
+        list.append('<tr><td colspan="5" class="text-muted">暂无测速结果</td></tr>');
+        return;
+    }
+    results.forEach(r => {
+        const row = $('<tr>');
+        row.append($('<td>').text(r.rank || '-'));
+        row.append($('<td class="text-break">').text(r.url));
+        row.append($('<td>').text(r.error ? '-' : r.speed_kb + ' KB/s'));
+        row.append($('<td>').text(r.error ? '-' : r.ttfb_ms + ' ms'));
+        row.append($('<td>').addClass(r.error ? 'text-danger' : 'text-success').text(r.error || '正常'));
+        list.append(row);
+    });
+}
+
+// --- 速度计划 ---
+
+// 每周 7x24 个时段，下标为 星期*24+小时（星期日为0）；-1 不限速，0 暂停，其他为 KB/s
+const speedProfileSlots = 7 * 24;
+let speedProfile = new Array(speedProfileSlots).fill(-1);
+let speedPainting = false;
+const speedDayNames = ['周日', '周一', '周二', '周三', '周四', '周五', '周六'];
+
+function loadSpeedProfile(profile) {
+    speedProfile = profile && profile.length === speedProfileSlots ? profile.slice() : new Array(speedProfileSlots).fill(-1);
+    renderSpeedGrid();
+}
+
+function describeSpeedSlot(value) {
+    if (value < 0) return '不限速';
+    if (value === 0) return '暂停';
+    return value + ' KB/s';
+}
+
+function renderSpeedGrid() {
+    const grid = $('#speedGrid').empty();
+    const header = $('<tr>').append('<th></th>');
+    for (let h = 0; h < 24; h++) {
+        header.append($('<th>').text(h));
+    }
+    grid.append(header);
+
+    // 从周一开始显示
+    [1, 2, 3, 4, 5, 6, 0].forEach(day => {
+        const row = $('<tr>').append($('<th>').text(speedDayNames[day]));
+        for (let h = 0; h < 24; h++) {
+            const cell = $('<td>').attr('data-slot', day * 24 + h);
+            row.append(cell);
+        }
+        grid.append(row);
+    });
+    grid.find('td').each(function () {
+        paintSpeedCell($(this));
+    }).on('mousedown', function (e) {
+        e.preventDefault();
+        speedPainting = true;
+        applySpeedBrush($(this));
+    }).on('mouseenter', function () {
+        if (speedPainting) {
+            applySpeedBrush($(this));
+        }
+    });
+}
+
+function paintSpeedCell(cell) {
+    const slot = parseInt(cell.attr('data-slot'), 10);
+    const value = speedProfile[slot];
+    const day = Math.floor(slot / 24);
+    const hour = slot % 24;
+    cell.removeClass('speed-unlimited speed-limited speed-paused')
+        .addClass(value < 0 ? 'speed-unlimited' : value === 0 ? 'speed-paused' : 'speed-limited')
+        .attr('title', `${speedDayNames[day]} ${hour}:00-${hour + 1}:00 ${describeSpeedSlot(value)}`);
+}
+
+function applySpeedBrush(cell) {
+    const type = $('#speedBrushType').val();
+    let value = -1;
+    if (type === 'paused') {
+        value = 0;
+    } else if (type === 'limited') {
+        value = Math.max(1, parseInt($('#speedBrushValue').val(), 10) || 1);
+    }
+    speedProfile[parseInt(cell.attr('data-slot'), 10)] = value;
+    paintSpeedCell(cell);
+}
+
+// --- 比例模式 ---
+
+function loadInterfaces() {
+    $.getJSON('/api/interfaces', function (data) {
+        const list = $('#interfaceOptions').empty();
+        (data || []).forEach(i => {
+            list.append($('<option>').val(i.name));
+        });
+    });
+}
+
+// --- 网卡流量 ---
+
+function renderInterfaces(interfaces) {
+    const names = Object.keys(interfaces).sort();
+    $('#interfaceStatus').toggleClass('d-none', names.length === 0);
+    const list = $('#interfaceList').empty();
+    names.forEach(name => {
+        const t = interfaces[name];
+        const row = $('<tr>');
+        row.append($('<td>').text(name));
+        row.append($('<td>').text(`${formatBytes(t.daily_rx)} / ${formatBytes(t.daily_tx)}`));
+        row.append($('<td>').text(`${formatBytes(t.monthly_rx)} / ${formatBytes(t.monthly_tx)}`));
+        row.append($('<td>').text(`${formatBytes(t.total_rx)} / ${formatBytes(t.total_tx)}`));
+        list.append(row);
+    });
+}
+
+// --- 下载任务 ---
+
+let taskCache = [];
+
+function loadTasks() {
+    $.getJSON('/api/tasks', renderTasks);
+}
+
+function describePlan(t) {
+    switch (t.plan_type) {
+        case 'daily':
+            return `每日 ${String(t.hour).padStart(2, '0')}:${String(t.minute).padStart(2, '0')}` +
+                (t.jitter_minutes ? ` ±${t.jitter_minutes} 分钟` : '');
+        case 'interval':
+            return `每 ${t.interval_minutes} 分钟`;
+        case 'cron':
+            return `cron ${t.cron_expr}`;
+        case 'continuous':
+            return t.cooldown_seconds ? `持续下载，冷却 ${t.cooldown_seconds} 秒` : '持续下载';
+        default:
+            return '-';
+    }
+}
+
+function renderTasks(data) {
+    taskCache = data || [];
+    const list = $('#taskList').empty();
+    if (taskCache.length === 0) {
+        list.append('<tr><td colspan="6" class="text-muted">暂无任务</td></tr>');
+        return;
+    }
+    taskCache.forEach(t => {
+        const rt = t.runtime || {};
+        const progress = rt.progress || {};
+        const downloading = rt.status === '下载中' || rt.status === '已暂停';
+        const queued = rt.status === '排队中';
+        const row = $('<tr>');
+        row.append($('<td>').text(t.name).toggleClass('text-muted', !t.enabled));
+        const schedule = rt.schedule || {};
+        let status = rt.status || '空闲';
+        if (schedule.consecutive_failures > 1) {
+            status += `（连续失败 ${schedule.consecutive_failures} 次）`;
+        }
+        row.append($('<td>').text(describePlan(t)));
+        row.append($('<td>').text(t.enabled ? formatNextRun(schedule.next_due) : '-'));
+        row.append($('<td>').text(status));
+        row.append($('<td>').text(downloading ? `${progress.percent}% · ${progress.speed} KB/s` : (progress.status || '-')));
+
+        const actions = $('<td class="text-nowrap">');
+        if (downloading || queued) {
+            actions.append($('<button type="button" class="btn btn-outline-danger btn-sm me-1">停止</button>').on('click', () => stopTask(t.id)));
+        } else {
+            actions.append($('<button type="button" class="btn btn-outline-success btn-sm me-1">运行</button>').on('click', () => runTask(t.id)));
+        }
+        // 主任务通过上方的配置表单修改
+        if (t.id !== 'main') {
+            actions.append($('<button type="button" class="btn btn-outline-primary btn-sm me-1">编辑</button>').on('click', () => editTask(t.id)));
+            actions.append($('<button type="button" class="btn btn-outline-secondary btn-sm">删除</button>').on('click', () => deleteTask(t.id, t.name)));
+        }
+        row.append(actions);
+        list.append(row);
+    });
+}
+
+function toggleTaskPlan() {
+    const type = $('#taskPlan').val();
+    $('.task-plan').addClass('d-none');
+    $('.task-plan-' + type).removeClass('d-none');
+}
+
+// 打开任务表单，不传 id 时为新建任务
+function editTask(id) {
+    const t = taskCache.find(t => t.id === id) || {
+        name: '', enabled: true, urls: [], url_strategy: 'round_robin',
+        plan_type: 'interval', interval_minutes: 60, cooldown_seconds: 0, hour: 3, minute: 0, jitter_minutes: 0, catch_up: 'skip', cron_expr: '', speed_kb: 0
+    };
+    $('#taskId').val(id || '');
+    $('#taskName').val(t.name);
+    $('#taskEnabledInput').prop('checked', t.enabled);
+    $('#taskUrls').val((t.urls || []).map(u => u.url).join('\n'));
+    $('#taskStrategy').val(t.url_strategy || 'round_robin');
+    $('#taskPlan').val(t.plan_type);
+    $('#taskInterval').val(t.interval_minutes || 60);
+    $('#taskCooldown').val(t.cooldown_seconds || 0);
+    $('#taskJitter').val(t.jitter_minutes || 0);
+    $('#taskCatchUp').val(t.catch_up || 'skip');
+    $('#taskTime').val(`${String(t.hour).padStart(2, '0')}:${String(t.minute).padStart(2, '0')}`);
+    $('#taskCron').val(t.cron_expr);
+    $('#taskSpeed').val(t.speed_kb);
+    toggleTaskPlan();
+    $('#taskForm').removeClass('d-none');
+}
+
+function cancelTaskEdit() {
+    $('#taskForm').addClass('d-none');
+}
+
+function saveTask() {
+    const id = $('#taskId').val();
+    const old = taskCache.find(t => t.id === id);
+    const time = ($('#taskTime').val() || '00:00').split(':');
+    // 保留已有地址的权重和启用状态
+    const urls = $('#taskUrls').val().split('\n').map(s => s.trim()).filter(s => s).map(url => {
+        const prev = old && (old.urls || []).find(u => u.url === url);
+        return prev || { url: url, weight: 1, enabled: true };
+    });
+    const task = {
+        name: $('#taskName').val(),
+        enabled: $('#taskEnabledInput').is(':checked'),
+        urls: urls,
+        url_strategy: $('#taskStrategy').val(),
+        plan_type: $('#taskPlan').val(),
+        interval_minutes: parseInt($('#taskInterval').val(), 10) || 0,
+        cooldown_seconds: parseInt($('#taskCooldown').val(), 10) || 0,
+        hour: parseInt(time[0], 10) || 0,
+        minute: parseInt(time[1], 10) || 0,
+        jitter_minutes: parseInt($('#taskJitter').val(), 10) || 0,
+        catch_up: $('#taskCatchUp').val(),
+        cron_expr: $('#taskCron').val(),
+        speed_kb: parseInt($('#taskSpeed').val(), 10) || 0
+    };
+    $.ajax({
+        url: id ? '/api/tasks?id=' + encodeURIComponent(id) : '/api/tasks',
+        type: id ? 'PUT' : 'POST',
+        data: JSON.stringify(task),
+        contentType: 'application/json',
+        success: function () {
+            cancelTaskEdit();
+            loadTasks();
+            showMessage('任务已保存', 'success');
+        },
+        error: function (jqXHR) {
+            showMessage(jqXHR.responseJSON ? jqXHR.responseJSON.error : '保存任务失败', 'error');
+        }
+    });
+}
+
+function deleteTask(id, name) {
+    if (!confirm(`确定删除任务「${name}」吗？`)) return;
+    $.ajax({
+        url: '/api/tasks?id=' + encodeURIComponent(id),
+        type: 'DELETE',
+        success: function () {
+            loadTasks();
+            showMessage('任务已删除', 'success');
+        },
+        error: function () {
+            showMessage('删除任务失败', 'error');
+        }
+    });
+}
+
+function runTask(id) {
+    $.post('/api/tasks/run?id=' + encodeURIComponent(id), function () {
+        showMessage('任务已开始', 'success');
+        setTimeout(loadTasks, 500);
+        if (id === 'main') {
+            pollProgress();
+        }
+    }).fail(function (jqXHR) {
+        showMessage(jqXHR.responseJSON ? jqXHR.responseJSON.error : '启动任务失败', 'error');
+    });
+}
+
+function stopTask(id) {
+    $.post('/api/tasks/stop?id=' + encodeURIComponent(id), function () {
+        showMessage('已发送停止信号', 'info');
+        setTimeout(loadTasks, 500);
+        setTimeout(loadQueue, 500);
+    }).fail(function () {
+        showMessage('停止任务失败', 'error');
+    });
+}
+
+// --- 下载队列 ---
+
+const queueSources = {
+    manual: '手动',
+    schedule: '计划',
+    ratio: '比例补齐',
+    continuous: '持续下载'
+};
+
+function loadQueue() {
+    $.getJSON('/api/queue', renderQueue);
+}
+
+function renderQueue(data) {
+    const running = data.running || [];
+    const pending = data.pending || [];
+    $('#queueSummary').text(`执行中 ${running.length}/${data.max_concurrent}，等待 ${pending.length}`);
+    const list = $('#queueList').empty();
+    if (running.length === 0 && pending.length === 0) {
+        list.append('<tr><td colspan="5" class="text-muted">队列为空</td></tr>');
+        return;
+    }
+    running.concat(pending).forEach(job => {
+        const row = $('<tr>');
+        row.append($('<td>').text(job.task_name));
+        row.append($('<td>').text(queueSources[job.source] || job.source));
+        row.append($('<td>').text(job.state).toggleClass('text-primary', job.state === '执行中'));
+        row.append($('<td>').text(formatTime(job.queued_at)));
+        const actions = $('<td>');
+        if (job.state === '等待中') {
+            actions.append($('<button type="button" class="btn btn-outline-secondary btn-sm">取消</button>').on('click', () => cancelQueued(job.id)));
+        }
+        row.append(actions);
+        list.append(row);
+    });
+}
+
+function cancelQueued(id) {
+    $.ajax({
+        url: '/api/queue?id=' + encodeURIComponent(id),
+        type: 'DELETE',
+        success: function () {
+            loadQueue();
+            loadTasks();
+            showMessage('已从队列中移除', 'success');
+        },
+        error: function (jqXHR) {
+            showMessage(jqXHR.responseJSON ? jqXHR.responseJSON.error : '取消失败', 'error');
+        }
+    });
+}
+
+// 切换每月下载量限制
+function toggleMonthlyLimit() {
+    $.post('/api/toggle_monthly_limit', function (data) {
+        updateStatus(data);
+        const message = data.config.monthly_limit_enabled ? '每月下载量限制已启用' : '每月下载量限制已关闭';
+        showMessage(message, 'success');
+    }).fail(function () {
+        showMessage('切换限制状态失败', 'error');
+    });
+}
+
+// --- 流量历史 ---
+
+let dailyHistory = [];
+let hourlyHistory = [];
+
+// 配置的时区，为空时使用浏览器的时区
+let displayTimezone = '';
+
+// 按配置的时区格式化时间
+function formatTime(value) {
+    const options = displayTimezone ? { timeZone: displayTimezone } : {};
+    try {
+        return new Date(value).toLocaleString(undefined, options);
+    } catch (e) {
+        return new Date(value).toLocaleString();
+    }
+}
+
+// 格式化下一次计划执行的时间，零值表示没有固定的执行时间
+function formatNextRun(value) {
+    if (!value || value.startsWith('0001')) {
+        return '-';
+    }
+    return new Date(value) <= new Date() ? '即将执行' : formatTime(value);
+}
+
+// 格式化为 yyyy-mm-dd
+function formatDate(d) {
+    return `${d.getFullYear()}-${String(d.getMonth() + 1).padStart(2, '0')}-${String(d.getDate()).padStart(2, '0')}`;
+}
+
+function loadHistory() {
+    const from = $('#historyFrom').val();
+    const to = $('#historyTo').val();
+    $.getJSON('/api/history', { from: from, to: to, granularity: 'day' }, function (data) {
+        dailyHistory = data.entries || [];
+        renderHistory();
+    }).fail(function (jqXHR) {
+        const err = jqXHR.responseJSON && jqXHR.responseJSON.error;
+        showMessage(err || '获取流量历史失败', 'error');
+    });
+
+    // 最近48小时，去掉尚未到来的小时
+    const now = new Date();
+    const yesterday = new Date(now.getTime() - 86400000);
+    const currentHour = `${formatDate(now)} ${String(now.getHours()).padStart(2, '0')}`;
+    $.getJSON('/api/history', { from: formatDate(yesterday), to: formatDate(now), granularity: 'hour' }, function (data) {
+        hourlyHistory = (data.entries || []).filter(e => e.time <= currentHour);
+        renderHistory();
+    });
+}
+
+function renderHistory() {
+    const dailyTotal = dailyHistory.reduce((sum, e) => sum + e.bytes, 0);
+    const dailyRuns = dailyHistory.reduce((sum, e) => sum + e.runs, 0);
+    const dailyFailures = dailyHistory.reduce((sum, e) => sum + e.failures, 0);
+    $('#dailySummary').text(`每日下载量（合计 ${formatBytes(dailyTotal)}，运行 ${dailyRuns} 次，失败 ${dailyFailures} 次）`);
+    MiniChart.bar(
+        document.getElementById('dailyChart'),
+        dailyHistory.map(e => e.time.substring(5)),
+        dailyHistory.map(e => e.bytes),
+        { format: formatBytes }
+    );
+
+    // 没有上传流量的日期比例记为0
+    const ratios = dailyHistory.map(e => e.tx ? e.rx / e.tx : 0);
+    const rxTotal = dailyHistory.reduce((sum, e) => sum + (e.rx || 0), 0);
+    const txTotal = dailyHistory.reduce((sum, e) => sum + (e.tx || 0), 0);
+    $('#ratioSummary').text(`每日网卡下载:上传比（合计下载 ${formatBytes(rxTotal)}，上传 ${formatBytes(txTotal)}）`);
+    MiniChart.bar(
+        document.getElementById('ratioChart'),
+        dailyHistory.map(e => e.time.substring(5)),
+        ratios,
+        { format: v => v.toFixed(2), color: '#6f42c1' }
+    );
+
+    const hourlyTotal = hourlyHistory.reduce((sum, e) => sum + e.bytes, 0);
+    $('#hourlySummary').text(`最近48小时下载量（合计 ${formatBytes(hourlyTotal)}）`);
+    MiniChart.bar(
+        document.getElementById('hourlyChart'),
+        hourlyHistory.map(e => e.time.substring(11) + '时'),
+        hourlyHistory.map(e => e.bytes),
+        { format: formatBytes, color: '#17a2b8' }
+    );
+}
+
+// --- 实时速度曲线 ---
+
+const speedSamples = [];
+const maxSpeedSamples = 120;
+
+function recordSpeed(speed) {
+    speedSamples.push(speed);
+    if (speedSamples.length > maxSpeedSamples) {
+        speedSamples.shift();
+    }
+    renderSparkline();
+}
+
+function renderSparkline() {
+    MiniChart.sparkline(document.getElementById('speedSparkline'), speedSamples);
+}
+
 // --- UI 逻辑 ---
 
 // 更新任务按钮状态
@@ -210,20 +752,123 @@ function updateLimitButton(enabled) {
     }
 }
 
+// 更新每月限制按钮状态
+function updateMonthlyLimitButton(enabled) {
+    const btn = $('#toggleMonthlyLimitBtn');
+    if (enabled) {
+        btn.text('❌ 关闭每月下载量限制')
+            .removeClass('btn-outline-warning btn-outline-secondary')
+            .addClass('btn-outline-secondary');
+    } else {
+        btn.text('📅 启用每月下载量限制')
+            .removeClass('btn-outline-warning btn-outline-secondary')
+            .addClass('btn-outline-warning');
+    }
+}
+
 // 根据计划类型显示/隐藏表单项
 function togglePlanType() {
     var type = $('#planType').val();
-    if (type === 'daily') {
-        $('#intervalGroup').addClass('d-none');
-        $('#hourGroup').removeClass('d-none');
-        $('#minuteGroup').removeClass('d-none');
-    } else {
-        $('#intervalGroup').removeClass('d-none');
-        $('#hourGroup').addClass('d-none');
-        $('#minuteGroup').addClass('d-none');
+    $('#intervalGroup').toggleClass('d-none', type !== 'interval');
+    $('#hourGroup').toggleClass('d-none', type !== 'daily');
+    $('#minuteGroup').toggleClass('d-none', type !== 'daily');
+    $('#cronGroup').toggleClass('d-none', type !== 'cron');
+    $('#cooldownGroup').toggleClass('d-none', type !== 'continuous');
+    $('#jitterGroup').toggleClass('d-none', type !== 'daily');
+    $('#catchUpGroup').toggleClass('d-none', type !== 'daily');
+    if (type === 'cron') {
+        previewCron();
+    }
+}
+
+// 预览 cron 表达式接下来的执行时间
+function previewCron() {
+    const expr = $('#cronInput').val().trim();
+    const list = $('#cronPreview').empty();
+    if (!expr) return;
+    $.getJSON('/api/cron/preview', { expr: expr, n: 5 }, function (data) {
+        (data.next || []).forEach(t => list.append($('<li>').text(t)));
+    }).fail(function (jqXHR) {
+        const err = jqXHR.responseJSON && jqXHR.responseJSON.error;
+        list.append($('<li class="text-danger">').text(err || '表达式无效'));
+    });
+}
+
+// --- URL列表 ---
+
+// 根据配置重新渲染URL列表
+function renderUrlList(urls) {
+    $('#urlList').empty();
+    urls.forEach(u => addUrlRow(u.url, u.weight, u.enabled));
+    if (urls.length === 0) {
+        addUrlRow();
     }
 }
 
+// 添加一行URL
+function addUrlRow(url = '', weight = 1, enabled = true) {
+    const row = $(`
+        <tr>
+            <td><input type="text" class="form-control form-control-sm url-input" placeholder="请输入文件下载地址"></td>
+            <td><input type="number" class="form-control form-control-sm weight-input" min="1" title="权重"></td>
+            <td><input type="checkbox" class="form-check-input enabled-input" title="是否启用"></td>
+            <td><button type="button" class="btn btn-outline-danger btn-sm" title="删除">✖</button></td>
+        </tr>`);
+    row.find('.url-input').val(url);
+    row.find('.weight-input').val(weight || 1);
+    row.find('.enabled-input').prop('checked', enabled);
+    row.find('button').on('click', () => row.remove());
+    $('#urlList').append(row);
+}
+
+// 收集URL列表，忽略空地址
+function collectUrls() {
+    const urls = [];
+    $('#urlList tr').each(function () {
+        const url = $(this).find('.url-input').val().trim();
+        if (!url) return;
+        urls.push({
+            url: url,
+            weight: parseInt($(this).find('.weight-input').val(), 10) || 1,
+            enabled: $(this).find('.enabled-input').prop('checked')
+        });
+    });
+    return urls;
+}
+
+// --- 允许下载的时段 ---
+
+function renderWindowList(windows) {
+    $('#windowList').empty();
+    windows.forEach(w => addWindowRow(w.start, w.end));
+}
+
+// 添加一行时段
+function addWindowRow(start = '00:00', end = '08:00') {
+    const row = $(`
+        <tr>
+            <td><input type="time" class="form-control form-control-sm window-start"></td>
+            <td><input type="time" class="form-control form-control-sm window-end"></td>
+            <td><button type="button" class="btn btn-outline-danger btn-sm" title="删除">✖</button></td>
+        </tr>`);
+    row.find('.window-start').val(start);
+    row.find('.window-end').val(end);
+    row.find('button').on('click', () => row.remove());
+    $('#windowList').append(row);
+}
+
+// 收集时段列表，忽略未填写完整的行
+function collectWindows() {
+    const windows = [];
+    $('#windowList tr').each(function () {
+        const start = $(this).find('.window-start').val();
+        const end = $(this).find('.window-end').val();
+        if (!start || !end) return;
+        windows.push({ start: start, end: end });
+    });
+    return windows;
+}
+
 // --- 数据与状态更新 ---
 
 // 使用服务器返回的数据更新整个页面（包括配置区）
@@ -238,15 +883,57 @@ function updateConfig(data) {
     if (!data) return;
 
     // 配置区
-    $('#urlInput').val(data.config.url || '');
+    renderUrlList(data.config.urls || []);
+    $('#urlStrategy').val(data.config.url_strategy || 'round_robin');
     $('#planType').val(data.config.plan_type || 'interval');
+    $('#cronInput').val(data.config.cron_expr || '');
     togglePlanType();
     $('#intervalInput').val(data.config.interval_minutes || 60);
+    $('#cooldownInput').val(data.config.cooldown_seconds || 0);
+    $('#timezoneInput').val(data.config.timezone || '');
+    displayTimezone = data.config.timezone || '';
+    $('#jitterInput').val(data.config.jitter_minutes || 0);
+    $('#catchUpInput').val(data.config.catch_up || 'skip');
     $('#hourInput').val(data.config.hour || 0);
     $('#minuteInput').val(data.config.minute || 0);
     $('#speedInput').val(data.config.speed_kb || 0);
+    $('#connectionsInput').val(data.config.connections || 1);
+    $('#maxConcurrentInput').val(data.config.max_concurrent || 1);
+    $('#runLimitMBInput').val(data.config.run_limit_mb || 0);
+    $('#runLimitMinutesInput').val(data.config.run_limit_minutes || 0);
+    $('#retryCountInput').val(data.config.retry_count || 0);
+    $('#retryDelayInput').val(data.config.retry_delay_seconds || 5);
+    $('#probeIntervalInput').val(data.config.probe_interval_minutes || 0);
+    $('#probeSizeInput').val(data.config.probe_size_kb || 1024);
     $('#dirInput').val(data.config.dir || '');
+    $('#sinkInput').prop('checked', !!data.config.sink_mode);
+    $('#speedProfileEnabledInput').prop('checked', !!data.config.speed_profile_enabled);
+    loadSpeedProfile(data.config.speed_profile);
+    $('#activeWindowsEnabledInput').prop('checked', !!data.config.active_windows_enabled);
+    renderWindowList(data.config.active_windows || []);
     $('#limitInput').val(data.config.limit_mb || 100);
+    $('#monthlyLimitInput').val(data.config.monthly_limit_mb || 0);
+    $('#billingDayInput').val(data.config.billing_day || 1);
+    $('#historyMonthsInput').val(data.config.history_months || 12);
+    $('#pacingEnabledInput').prop('checked', !!data.config.pacing_enabled);
+    $('#pacingTargetInput').val(data.config.pacing_target_mb || 1024);
+    const humanize = data.config.humanize || {};
+    $('#humanizeEnabledInput').prop('checked', !!humanize.enabled);
+    $('#humanizeSeedInput').val(humanize.seed || 0);
+    $('#humanizeJitterInput').val(humanize.start_jitter_seconds || 0);
+    $('#humanizeRunMinInput').val(humanize.run_min_mb || 0);
+    $('#humanizeRunMaxInput').val(humanize.run_max_mb || 0);
+    $('#humanizeRateMinInput').val(humanize.rate_min_kb || 0);
+    $('#humanizeRateMaxInput').val(humanize.rate_max_kb || 0);
+    $('#humanizeIdleEveryInput').val(humanize.idle_every_minutes || 0);
+    $('#humanizeIdleMinInput').val(humanize.idle_min_seconds || 0);
+    $('#humanizeIdleMaxInput').val(humanize.idle_max_seconds || 0);
+    $('#limitSourceInput').val(data.config.limit_source || 'self');
+    $('#monitorInterfacesInput').val((data.config.monitor_interfaces || []).join(', '));
+    $('#netDevPathInput').val(data.config.net_dev_path || '');
+    $('#ratioEnabledInput').prop('checked', !!data.config.ratio_enabled);
+    $('#ratioInterfaceInput').val(data.config.ratio_interface || '');
+    $('#ratioTargetInput').val(data.config.ratio_target || 1);
 }
 
 // 只更新状态区域（不更新配置）
@@ -255,6 +942,7 @@ function updateStatus(data) {
 
     // 状态区
     $('#dirText').text(data.config.dir || '-');
+    $('#sinkText').text(data.config.sink_mode ? '丢弃（不落盘）' : '保存到磁盘');
 
     // 任务运行状态加上颜色指示
     const taskStatus = data.task_status || '-';
@@ -266,9 +954,17 @@ function updateStatus(data) {
         case '下载中':
             statusElement.addClass('text-primary');
             break;
+        case '已暂停':
+        case '已跳过':
+        case '已停止':
+            statusElement.addClass('text-warning');
+            break;
         case '失败':
             statusElement.addClass('text-danger');
             break;
+        case '排队中':
+            statusElement.addClass('text-primary');
+            break;
         case '空闲':
             statusElement.addClass('text-success');
             break;
@@ -288,10 +984,20 @@ function updateStatus(data) {
     let planText = '';
     if (data.config.plan_type === 'daily') {
         planText = `每天 ${String(data.config.hour || 0).padStart(2, '0')}:${String(data.config.minute || 0).padStart(2, '0')} 执行`;
+        if (data.config.jitter_minutes) {
+            planText += `（±${data.config.jitter_minutes} 分钟）`;
+        }
+    } else if (data.config.plan_type === 'cron') {
+        planText = `Cron: ${data.config.cron_expr || '-'}`;
+    } else if (data.config.plan_type === 'continuous') {
+        planText = data.config.cooldown_seconds
+            ? `持续下载，每次结束后等待 ${data.config.cooldown_seconds} 秒`
+            : '持续下载';
     } else {
         planText = `每隔 ${data.config.interval_minutes || 60} 分钟执行`;
     }
     $('#planTypeText').text(planText);
+    $('#nextRunText').text(data.task_enabled ? formatNextRun(data.next_run_at) : '-');
 
     const limitEnabled = $('#limitEnabled');
     limitEnabled.text(data.config.daily_limit_enabled ? '已启用' : '已禁用');
@@ -301,16 +1007,59 @@ function updateStatus(data) {
         limitEnabled.removeClass('text-success').addClass('text-danger');
     }
     $('#limitMB').text((data.config.limit_mb || 0) + ' MB');
-    $('#todayMB').text((data.stats.daily_downloaded_mb || 0) + ' MB');
-    $('#monthMB').text((data.stats.monthly_downloaded_mb || 0) + ' MB');
+    $('#todayMB').text(formatBytes(data.stats.daily_downloaded_bytes || 0));
+    $('#monthMB').text(formatBytes(data.stats.monthly_downloaded_bytes || 0));
+    $('#totalMB').text(formatBytes(data.stats.total_downloaded_bytes || 0));
+
+    const monthlyLimitEnabled = $('#monthlyLimitEnabled');
+    monthlyLimitEnabled.text(data.config.monthly_limit_enabled ? '已启用' : '已禁用');
+    if (data.config.monthly_limit_enabled) {
+        monthlyLimitEnabled.removeClass('text-danger').addClass('text-success');
+    } else {
+        monthlyLimitEnabled.removeClass('text-success').addClass('text-danger');
+    }
+    $('#monthlyLimitMB').text((data.config.monthly_limit_mb || 0) + ' MB');
+    $('#cycleStart').text(data.stats.last_stat_month || '-');
+
+    if (data.config.pacing_enabled) {
+        const target = (data.config.pacing_target_mb || 0) * 1024 * 1024;
+        const done = data.stats.daily_downloaded_bytes || 0;
+        const percent = target > 0 ? Math.min(100, Math.floor(done * 100 / target)) : 0;
+        $('#pacingProgress').text(`${formatBytes(done)} / ${formatBytes(target)}（${percent}%）`);
+    } else {
+        $('#pacingProgress').text('未启用');
+    }
+
+    const interfaces = data.stats.interfaces || {};
+    if (data.config.ratio_enabled) {
+        const traffic = interfaces[data.config.ratio_interface] || {};
+        const rx = traffic.daily_rx || 0;
+        const tx = traffic.daily_tx || 0;
+        const ratio = tx > 0 ? (rx / tx).toFixed(2) : '-';
+        $('#ratioText').text(`${formatBytes(rx)} / ${formatBytes(tx)}（比例 ${ratio}，目标 ${data.config.ratio_target}）`);
+    } else {
+        $('#ratioText').text('未启用');
+    }
+    renderInterfaces(interfaces);
 
     // 改进按钮文本和样式
     updateTaskButton(data.task_enabled);
     updateLimitButton(data.config.daily_limit_enabled);
+    updateMonthlyLimitButton(data.config.monthly_limit_enabled);
 
     // 下载状态区
     $('#lastDownload').text(data.stats.last_download || '-');
     $('#lastFile').text(data.stats.last_file || '-');
+    $('#lastURL').text(data.stats.last_url || '-');
+
+    // 最近一次下载的重试记录
+    const attempts = data.stats.last_attempts || [];
+    if (attempts.length > 0) {
+        $('#attemptsText').text(attempts.map(a => `[${a.time}] ${a.label}: ${a.error}`).join('；'));
+        $('#attemptsRow').removeClass('d-none');
+    } else {
+        $('#attemptsRow').addClass('d-none');
+    }
     $('#msg').text(data.stats.message || '-');
 
     // 如果从/status接口获取的状态是“下载中”，则启动轮询
@@ -319,6 +1068,18 @@ function updateStatus(data) {
     }
 }
 
+// 将字节数格式化为易读的大小
+function formatBytes(bytes) {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let value = bytes;
+    let i = 0;
+    while (value >= 1024 && i < units.length - 1) {
+        value /= 1024;
+        i++;
+    }
+    return (i === 0 ? value : value.toFixed(2)) + ' ' + units[i];
+}
+
 let progressTimer = null;
 let statusTimer = null;
 
@@ -350,8 +1111,18 @@ function pollProgress() {
             // 更新进度UI
             $('#progressText').text(percent + '%');
             $('#speedText').text(speed + ' KB/s');
+            recordSpeed(speed);
             $('#sizeText').text(sizeText);
 
+            // 多连接下载时显示每个连接的速度
+            const connections = data.connections || [];
+            if (connections.length > 1) {
+                $('#connectionsText').text(connections.map(c => `#${c.id} ${c.speed} KB/s`).join('，'));
+                $('#connectionsRow').removeClass('d-none');
+            } else {
+                $('#connectionsRow').addClass('d-none');
+            }
+
             // 更新进度条，添加颜色变化
             const progressBar = $('#progressBar');
             progressBar.css('width', percent + '%').text(percent + '%');
@@ -367,7 +1138,7 @@ function pollProgress() {
             }
 
             // 当下载完成、失败、停止或进入空闲时，停止轮询
-            if (percent >= 100 || status === '下载完成' || status === '下载失败' || status === '已手动停止' || status === '空闲') {
+            if (percent >= 100 || status.startsWith('下载完成') || status === '下载失败' || status === '已手动停止' || status === '空闲') {
                 clearInterval(progressTimer);
                 progressTimer = null;
                 // 延迟一点时间后获取最终状态，确保后端已更新完毕
@@ -0,0 +1,121 @@
+// 基于 Canvas 的简易图表，不依赖外部库，保证在离线环境下可用
+const MiniChart = (function () {
+
+    // 按设备像素比设置画布尺寸，返回绘图上下文和逻辑尺寸
+    function setup(canvas) {
+        const ratio = window.devicePixelRatio || 1;
+        const width = canvas.clientWidth;
+        const height = canvas.clientHeight;
+        canvas.width = width * ratio;
+        canvas.height = height * ratio;
+        const ctx = canvas.getContext('2d');
+        ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+        ctx.clearRect(0, 0, width, height);
+        return { ctx, width, height };
+    }
+
+    // 柱状图，鼠标悬停时显示对应的数值
+    function bar(canvas, labels, values, options = {}) {
+        const format = options.format || (v => String(v));
+        const color = options.color || '#007bff';
+        const padding = { top: 20, right: 10, bottom: 24, left: 70 };
+
+        function draw(hover) {
+            const { ctx, width, height } = setup(canvas);
+            const plotW = width - padding.left - padding.right;
+            const plotH = height - padding.top - padding.bottom;
+            const max = Math.max(...values, 1);
+
+            ctx.font = '11px sans-serif';
+            ctx.fillStyle = '#6c757d';
+            ctx.strokeStyle = '#dee2e6';
+
+            // 纵轴刻度
+            const ticks = 4;
+            ctx.textAlign = 'right';
+            ctx.textBaseline = 'middle';
+            for (let i = 0; i <= ticks; i++) {
+                const y = padding.top + plotH - plotH * i / ticks;
+                ctx.beginPath();
+                ctx.moveTo(padding.left, y);
+                ctx.lineTo(width - padding.right, y);
+                ctx.stroke();
+                ctx.fillText(format(max * i / ticks), padding.left - 6, y);
+            }
+
+            if (values.length === 0) return;
+
+            // 柱子
+            const step = plotW / values.length;
+            const barW = Math.max(1, step * 0.7);
+            values.forEach((v, i) => {
+                const h = plotH * v / max;
+                ctx.fillStyle = i === hover ? '#0056b3' : color;
+                ctx.fillRect(padding.left + i * step + (step - barW) / 2, padding.top + plotH - h, barW, h);
+            });
+
+            // 横轴标签，根据宽度自动间隔显示
+            ctx.fillStyle = '#6c757d';
+            ctx.textAlign = 'center';
+            ctx.textBaseline = 'top';
+            const every = Math.ceil(values.length / Math.max(1, Math.floor(plotW / 60)));
+            labels.forEach((label, i) => {
+                if (i % every === 0) {
+                    ctx.fillText(label, padding.left + i * step + step / 2, padding.top + plotH + 6);
+                }
+            });
+
+            // 悬停提示
+            if (hover !== undefined && hover >= 0 && hover < values.length) {
+                ctx.fillStyle = '#212529';
+                ctx.textAlign = 'left';
+                ctx.textBaseline = 'top';
+                ctx.fillText(`${labels[hover]}: ${format(values[hover])}`, padding.left, 2);
+            }
+        }
+
+        canvas.onmousemove = function (e) {
+            const rect = canvas.getBoundingClientRect();
+            const step = (rect.width - padding.left - padding.right) / Math.max(1, values.length);
+            draw(Math.floor((e.clientX - rect.left - padding.left) / step));
+        };
+        canvas.onmouseleave = function () {
+            draw();
+        };
+        draw();
+    }
+
+    // 迷你折线图，用于显示实时速度
+    function sparkline(canvas, values, options = {}) {
+        const color = options.color || '#28a745';
+        const { ctx, width, height } = setup(canvas);
+        if (values.length < 2) return;
+
+        const max = Math.max(...values, 1);
+        const step = width / (values.length - 1);
+        const y = v => height - 2 - (height - 4) * v / max;
+
+        ctx.beginPath();
+        values.forEach((v, i) => {
+            if (i === 0) {
+                ctx.moveTo(0, y(v));
+            } else {
+                ctx.lineTo(i * step, y(v));
+            }
+        });
+        ctx.strokeStyle = color;
+        ctx.lineWidth = 1.5;
+        ctx.stroke();
+
+        // 填充折线下方区域
+        ctx.lineTo(width, height);
+        ctx.lineTo(0, height);
+        ctx.closePath();
+        ctx.globalAlpha = 0.15;
+        ctx.fillStyle = color;
+        ctx.fill();
+        ctx.globalAlpha = 1;
+    }
+
+    return { bar, sparkline };
+})();